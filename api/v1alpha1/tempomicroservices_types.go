@@ -19,61 +19,320 @@ package v1alpha1
 import (
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// ManagementStateType defines the type for CR management states.
+//
+// +kubebuilder:validation:Enum=Managed;Unmanaged;Preview
+type ManagementStateType string
+
+const (
+	// ManagementStateManaged when the TempoMicroservices custom resource should be
+	// reconciled by the operator.
+	ManagementStateManaged ManagementStateType = "Managed"
+
+	// ManagementStateUnmanaged when the TempoMicroservices custom resource should not be
+	// reconciled by the operator. The status field is still updated.
+	ManagementStateUnmanaged ManagementStateType = "Unmanaged"
+
+	// ManagementStatePreview when the operator should compute the changes required to
+	// reconcile the TempoMicroservices custom resource, without applying them.
+	// The pending changes are reported in the status field.
+	ManagementStatePreview ManagementStateType = "Preview"
+)
+
+// ReconcileAnnotation is the annotation key to opt-out live objects from reconciliation by the operator.
+const ReconcileAnnotation = "tempo.grafana.com/reconcile"
+
+// ReconcileMode defines the type for the values of the tempo.grafana.com/reconcile annotation.
+type ReconcileMode string
+
+const (
+	// ReconcileModeSkip when the operator should neither update nor delete the object.
+	ReconcileModeSkip ReconcileMode = "skip"
+
+	// ReconcileModeCreateOnly when the operator should create the object if it does not exist,
+	// but never update or delete it afterwards.
+	ReconcileModeCreateOnly ReconcileMode = "create-only"
+)
+
+// ReadinessGate defines a group of workloads which must be ready before the next group of objects is applied.
+// The managed objects are applied in the following order: ServiceAccounts and RBAC, ConfigMaps and Secrets,
+// Services, StatefulSets, Deployments and all remaining objects.
+//
+// +kubebuilder:validation:Enum=StatefulSets;Deployments
+type ReadinessGate string
+
+const (
+	// ReadinessGateStatefulSets waits for all StatefulSets (e.g. the ingesters) to be ready.
+	ReadinessGateStatefulSets ReadinessGate = "StatefulSets"
+	// ReadinessGateDeployments waits for all Deployments to be ready.
+	ReadinessGateDeployments ReadinessGate = "Deployments"
+)
+
+// SelectorChangeStrategy defines how a Deployment is updated if its label selector changed.
+// The label selector of a Deployment is immutable, therefore the Deployment needs to be re-created.
+//
+// +kubebuilder:validation:Enum=Delete;Recreate
+type SelectorChangeStrategy string
+
+const (
+	// SelectorChangeStrategyDelete deletes the Deployment and creates it again on the next reconcile.
+	// All pods of the Deployment are terminated at once.
+	SelectorChangeStrategyDelete SelectorChangeStrategy = "Delete"
+
+	// SelectorChangeStrategyRecreate creates a temporary Deployment with a suffixed name and the new label selector.
+	// Once the temporary Deployment is ready, the Deployment is deleted and created again with the new label selector.
+	// The temporary Deployment is deleted once the new Deployment is ready.
+	SelectorChangeStrategyRecreate SelectorChangeStrategy = "Recreate"
+)
+
+// IngesterRolloutStrategy defines how the pods of the ingester StatefulSet are updated.
+//
+// +kubebuilder:validation:Enum=RollingUpdate;Graceful
+type IngesterRolloutStrategy string
+
+const (
+	// IngesterRolloutStrategyRollingUpdate updates the ingester pods with the RollingUpdate strategy of the StatefulSet.
+	IngesterRolloutStrategyRollingUpdate IngesterRolloutStrategy = "RollingUpdate"
+
+	// IngesterRolloutStrategyGraceful updates the ingester pods one by one, orchestrated by the operator.
+	// Before a pod is deleted, the operator flushes and shuts down the ingester, and waits until it left the ring.
+	// The next pod is updated once the new pod is ready and joined the ring.
+	IngesterRolloutStrategyGraceful IngesterRolloutStrategy = "Graceful"
+)
+
+// PruningSpec defines the deletion of owned objects, which are not rendered by the helm chart anymore.
+type PruningSpec struct {
+	// Enabled defines if objects controlled by the TempoMicroservices instance are deleted, once they are not rendered by the helm chart anymore.
+	// Objects opted-out of reconciliation by the tempo.grafana.com/reconcile annotation are never deleted.
+	// Default is false.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Enabled",xDescriptors="urn:alm:descriptor:com.tectonic.ui:booleanSwitch"
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// RingCleanupSpec defines the removal of ingesters from the ring, whose pods no longer exist.
+type RingCleanupSpec struct {
+	// Enabled defines if ingesters are removed from the ring, if they are LEAVING or UNHEALTHY and their pod does not exist.
+	// Default is false.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Enabled",xDescriptors="urn:alm:descriptor:com.tectonic.ui:booleanSwitch"
+	Enabled bool `json:"enabled,omitempty"`
+
+	// GracePeriod defines how long an ingester without a pod stays in the ring, before it is removed.
+	// Default is 10m.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="10m"
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Grace Period"
+	GracePeriod metav1.Duration `json:"gracePeriod,omitempty"`
+}
+
+// ZoneLabel contains the zone of a zone-aware ingester StatefulSet and its pods.
+const ZoneLabel = "tempo.grafana.com/zone"
+
+// ZoneAwarenessSpec defines the zone-aware replication of the ingesters.
+type ZoneAwarenessSpec struct {
+	// Enabled defines if the ingesters are deployed with one StatefulSet per zone, and if zone-aware replication is enabled.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Enabled",xDescriptors="urn:alm:descriptor:com.tectonic.ui:booleanSwitch"
+	Enabled bool `json:"enabled"`
+
+	// TopologyKey is the node label containing the zone of a node.
+	// Default is topology.kubernetes.io/zone.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="topology.kubernetes.io/zone"
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Topology Key"
+	TopologyKey string `json:"topologyKey,omitempty"`
+
+	// Zones lists the values of the topology key, an ingester StatefulSet is created for each zone.
+	// The zone is appended to the name of the StatefulSet, therefore it must be a valid DNS label.
+	// The replicas of the ingester are distributed evenly across the zones.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Zones"
+	Zones []string `json:"zones,omitempty"`
+}
+
+// MaintenanceWindow defines a recurring time window, in which disruptive changes are applied.
+type MaintenanceWindow struct {
+	// Schedule is the start of the maintenance window in cron format, e.g. "0 2 * * 6" for every Saturday at 02:00 UTC.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Schedule"
+	Schedule string `json:"schedule"`
+
+	// Duration of the maintenance window.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Duration"
+	Duration metav1.Duration `json:"duration"`
+}
+
+// StorageProbeSpec defines the connectivity check of the trace storage.
+type StorageProbeSpec struct {
+	// Enabled defines if the operator lists the bucket of the trace storage, and writes and deletes a sentinel object
+	// with the credentials of the Tempo components before the manifests are applied.
+	// The check runs whenever the helm values change, and is retried every minute until it succeeds.
+	// The result is reported in the StorageUnreachable condition.
+	// Only the s3 backend with access keys is supported, the check of other backends is reported as skipped.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Enabled"
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// HealthProbesSpec defines the active probing of the HTTP endpoints of the Tempo components.
+type HealthProbesSpec struct {
+	// Enabled defines if the readiness endpoints of the query-frontend and distributor, the echo endpoint of the query-frontend
+	// and the ingester ring are probed through the Services of the components on every reconciliation, and at least once per minute.
+	// The result is reported in the Serving condition.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Enabled"
+	Enabled bool `json:"enabled,omitempty"`
+}
+
 // TempoMicroservicesSpec defines the desired state of TempoMicroservices
 type TempoMicroservicesSpec struct {
 	Chart  string               `json:"chart,omitempty"`
 	Values apiextensionsv1.JSON `json:"values,omitempty"`
-}
 
-// PodStatusMap defines the type for mapping pod status to pod name.
-type PodStatusMap map[corev1.PodPhase][]string
+	// ManagementState defines if the CR should be managed by the operator or not.
+	// Default is managed.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=Managed
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Management State"
+	ManagementState ManagementStateType `json:"managementState,omitempty"`
 
-// ComponentStatus defines the status of each component.
-type ComponentStatus struct {
-	// Compactor is a map of the pod status of the Compactor pods.
+	// Pruning defines the deletion of owned objects, which are not rendered by the helm chart anymore.
+	// If pruning is disabled, the Preview management state does not report deletions.
 	//
 	// +optional
 	// +kubebuilder:validation:Optional
-	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="Compactor",order=1,xDescriptors="urn:alm:descriptor:com.tectonic.ui:podStatuses"
-	Compactor PodStatusMap `json:"compactor"`
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Pruning"
+	Pruning PruningSpec `json:"pruning,omitempty"`
 
-	// Distributor is a map of the pod status of the Distributor pods.
+	// ReadinessGates defines the workloads which must be ready before the next group of objects is applied.
+	// For example, with the StatefulSets gate the Deployments are applied once all StatefulSets (e.g. the ingesters) are ready.
+	// By default, no readiness gate is configured and all objects are applied at once.
 	//
 	// +optional
 	// +kubebuilder:validation:Optional
-	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="Distributor",order=2,xDescriptors="urn:alm:descriptor:com.tectonic.ui:podStatuses"
-	Distributor PodStatusMap `json:"distributor"`
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Readiness Gates"
+	ReadinessGates []ReadinessGate `json:"readinessGates,omitempty"`
 
-	// Ingester is a map of the pod status of the Ingester pods.
+	// SelectorChangeStrategy defines how a Deployment is updated if its label selector changed.
+	// Default is Delete.
 	//
 	// +optional
 	// +kubebuilder:validation:Optional
-	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="Ingester",order=3,xDescriptors="urn:alm:descriptor:com.tectonic.ui:podStatuses"
-	Ingester PodStatusMap `json:"ingester"`
+	// +kubebuilder:default:=Delete
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Selector Change Strategy"
+	SelectorChangeStrategy SelectorChangeStrategy `json:"selectorChangeStrategy,omitempty"`
+
+	// IngesterRolloutStrategy defines how the pods of the ingester StatefulSet are updated.
+	// Default is RollingUpdate.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=RollingUpdate
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Ingester Rollout Strategy"
+	IngesterRolloutStrategy IngesterRolloutStrategy `json:"ingesterRolloutStrategy,omitempty"`
+
+	// RingCleanup defines the removal of ingesters from the ring, whose pods no longer exist.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Ring Cleanup"
+	RingCleanup RingCleanupSpec `json:"ringCleanup,omitempty"`
+
+	// ZoneAwareness defines the zone-aware replication of the ingesters.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Zone Awareness"
+	ZoneAwareness ZoneAwarenessSpec `json:"zoneAwareness,omitempty"`
+
+	// MaintenanceWindows defines the time windows, in which disruptive changes are applied.
+	// Disruptive changes are the re-creation of objects, the rotation of the CA certificate, restarts of the ingesters
+	// and upgrades of the helm chart. All other changes are applied immediately.
+	// A rotation of the CA certificate is applied immediately as well, if a certificate would expire before the next maintenance window.
+	// If no maintenance window is defined, all changes are applied immediately.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Maintenance Windows"
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+
+	// HealthProbes defines the active probing of the HTTP endpoints of the Tempo components.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Health Probes"
+	HealthProbes HealthProbesSpec `json:"healthProbes,omitempty"`
+
+	// StorageProbe defines the connectivity check of the trace storage.
+	// The check runs in the operator, not in the pods of the Tempo components, therefore only the access keys of the s3 backend are checked.
+	// The credentials of the gcs and azure backends, and s3 credentials provided by the IAM role of the pods, are not checked;
+	// invalid credentials of these are only reported by the Tempo components once they access the trace storage.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Storage Probe"
+	StorageProbe StorageProbeSpec `json:"storageProbe,omitempty"`
+}
+
+// PodStatusMap defines the type for mapping pod status to pod name.
+type PodStatusMap map[corev1.PodPhase][]string
 
-	// Querier is a map of the pod status of the Querier pods.
+// ComponentStatus defines the status of a component.
+type ComponentStatus struct {
+	// Component is the value of the app.kubernetes.io/component label of the workloads of the component.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	Component string `json:"component"`
+
+	// Pods is a map of the pod status of the pods of the component.
 	//
 	// +optional
 	// +kubebuilder:validation:Optional
-	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="Querier",order=4,xDescriptors="urn:alm:descriptor:com.tectonic.ui:podStatuses"
-	Querier PodStatusMap `json:"querier"`
+	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="Pods",xDescriptors="urn:alm:descriptor:com.tectonic.ui:podStatuses"
+	Pods PodStatusMap `json:"pods,omitempty"`
 
-	// QueryFrontend is a map of the pod status of the QueryFrontend pods.
+	// Zones is a map of the pod status of the pods of the component per zone, if zone awareness is enabled.
 	//
 	// +optional
 	// +kubebuilder:validation:Optional
-	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="QueryFrontend",order=5,xDescriptors="urn:alm:descriptor:com.tectonic.ui:podStatuses"
-	QueryFrontend PodStatusMap `json:"queryFrontend"`
+	Zones map[string]PodStatusMap `json:"zones,omitempty"`
 
-	// Observatorium is a map of the pod status of the Observatorium pods.
+	// Conditions of the component (Available, Progressing and Degraded), computed from the status of its workloads.
 	//
 	// +optional
 	// +kubebuilder:validation:Optional
-	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="Observatorium",order=6,xDescriptors="urn:alm:descriptor:com.tectonic.ui:podStatuses"
-	Observatorium PodStatusMap `json:"observatorium"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // ConditionStatus defines the status of a condition (e.g. ready, failed, pending or configuration error).
@@ -88,6 +347,21 @@ const (
 	ConditionPending ConditionStatus = "Pending"
 	// ConditionConfigurationError defines that there is a configuration error.
 	ConditionConfigurationError ConditionStatus = "ConfigurationError"
+	// ConditionScalingDown defines that ingesters are shut down before the replicas of the ingester StatefulSet are decreased.
+	ConditionScalingDown ConditionStatus = "ScalingDown"
+
+	// ConditionAvailable defines that all replicas of a component are available.
+	ConditionAvailable ConditionStatus = "Available"
+	// ConditionProgressing defines that a rollout of a component is in progress.
+	ConditionProgressing ConditionStatus = "Progressing"
+	// ConditionDegraded defines that a component is not fully available, and not making progress.
+	ConditionDegraded ConditionStatus = "Degraded"
+	// ConditionRingHealthy defines that at least one ingester is active in the ring, and no ingester is unhealthy.
+	ConditionRingHealthy ConditionStatus = "RingHealthy"
+	// ConditionServing defines that the Tempo components serve requests, as determined by active probes.
+	ConditionServing ConditionStatus = "Serving"
+	// ConditionStorageUnreachable defines that the trace storage cannot be accessed, as determined by the storage probe.
+	ConditionStorageUnreachable ConditionStatus = "StorageUnreachable"
 )
 
 // ConditionReason defines possible reasons for each condition.
@@ -104,24 +378,308 @@ const (
 	ReasonFailedReconciliation ConditionReason = "FailedReconciliation"
 	// ReasonInvalidStorageConfig defines that the object storage configuration is invalid (missing or incomplete storage secret).
 	ReasonInvalidStorageConfig ConditionReason = "InvalidStorageConfig"
+	// ReasonShuttingDownIngesters when the departing ingesters of a scale-down are flushed and shut down.
+	ReasonShuttingDownIngesters ConditionReason = "ShuttingDownIngesters"
+	// ReasonInvalidZoneAwareness defines that the zone-aware replication of the ingesters is misconfigured.
+	ReasonInvalidZoneAwareness ConditionReason = "InvalidZoneAwareness"
+	// ReasonInvalidMaintenanceWindow defines that the schedule of a maintenance window is invalid.
+	ReasonInvalidMaintenanceWindow ConditionReason = "InvalidMaintenanceWindow"
+	// ReasonReplicasAvailable when all replicas of the workloads of a component are available.
+	ReasonReplicasAvailable ConditionReason = "ReplicasAvailable"
+	// ReasonReplicasUnavailable when some replicas of the workloads of a component are not available.
+	ReasonReplicasUnavailable ConditionReason = "ReplicasUnavailable"
+	// ReasonRollingOut when the pods of a component are being updated.
+	ReasonRollingOut ConditionReason = "RollingOut"
+	// ReasonRolloutComplete when all pods of a component are updated.
+	ReasonRolloutComplete ConditionReason = "RolloutComplete"
+	// ReasonProgressDeadlineExceeded when the rollout of a Deployment did not make progress within its progress deadline.
+	ReasonProgressDeadlineExceeded ConditionReason = "ProgressDeadlineExceeded"
+	// ReasonReplicaFailure when the pods of a Deployment cannot be created.
+	ReasonReplicaFailure ConditionReason = "ReplicaFailure"
+	// ReasonAsExpected when a component is not degraded.
+	ReasonAsExpected ConditionReason = "AsExpected"
+	// ReasonImagePullFailed when the image of a container of a Tempo component cannot be pulled.
+	ReasonImagePullFailed ConditionReason = "ImagePullFailed"
+	// ReasonCrashLooping when a container of a Tempo component is restarted repeatedly.
+	ReasonCrashLooping ConditionReason = "CrashLooping"
+	// ReasonOOMKilled when a container of a Tempo component was terminated because it ran out of memory.
+	ReasonOOMKilled ConditionReason = "OOMKilled"
+	// ReasonProbesSucceeded when all probes of the HTTP endpoints of the Tempo components succeeded.
+	ReasonProbesSucceeded ConditionReason = "ProbesSucceeded"
+	// ReasonProbeFailed when a probe of an HTTP endpoint of a Tempo component failed.
+	ReasonProbeFailed ConditionReason = "ProbeFailed"
+	// ReasonRingHealthy when at least one ingester is active in the ring, and no ingester is unhealthy.
+	ReasonRingHealthy ConditionReason = "RingHealthy"
+	// ReasonRingUnavailable when the ingester ring cannot be read from the distributor.
+	ReasonRingUnavailable ConditionReason = "RingUnavailable"
+	// ReasonRingUnhealthy when the ingester ring has no active or any unhealthy ingesters.
+	ReasonRingUnhealthy ConditionReason = "RingUnhealthy"
+	// ReasonStorageReachable when the bucket of the trace storage can be listed, and objects can be written and deleted.
+	ReasonStorageReachable ConditionReason = "StorageReachable"
+	// ReasonBucketNotFound when the bucket of the trace storage does not exist.
+	ReasonBucketNotFound ConditionReason = "BucketNotFound"
+	// ReasonAccessDenied when the credentials of the trace storage are invalid, or not authorized to access the bucket.
+	ReasonAccessDenied ConditionReason = "AccessDenied"
+	// ReasonStorageProbeFailed when the trace storage cannot be accessed for any other reason, e.g. an unreachable endpoint.
+	ReasonStorageProbeFailed ConditionReason = "StorageProbeFailed"
+	// ReasonStorageProbeSkipped when the storage backend or its credentials are not supported by the storage probe.
+	ReasonStorageProbeSkipped ConditionReason = "StorageProbeSkipped"
+)
+
+// PendingChangeAction defines the action which would be performed on a managed object.
+type PendingChangeAction string
+
+const (
+	// PendingChangeCreate defines that the object does not exist yet and would be created.
+	PendingChangeCreate PendingChangeAction = "Create"
+	// PendingChangeUpdate defines that the object exists and would be updated.
+	PendingChangeUpdate PendingChangeAction = "Update"
+	// PendingChangeRecreate defines that an immutable field of the object changed,
+	// therefore the object would be deleted and re-created.
+	PendingChangeRecreate PendingChangeAction = "Recreate"
+	// PendingChangeDelete defines that the object is not rendered anymore and would be deleted.
+	PendingChangeDelete PendingChangeAction = "Delete"
+)
+
+// PendingChange describes a change to a managed object which has not been applied yet.
+type PendingChange struct {
+	// Kind of the object.
+	Kind string `json:"kind"`
+
+	// Name of the object.
+	Name string `json:"name"`
+
+	// Action which would be performed on the object.
+	Action PendingChangeAction `json:"action"`
+
+	// Fields contains the paths of the fields which would be changed by an update.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	Fields []string `json:"fields,omitempty"`
+}
+
+// UserOwnedObject describes an object which is excluded from reconciliation by the tempo.grafana.com/reconcile annotation.
+type UserOwnedObject struct {
+	// Kind of the object.
+	Kind string `json:"kind"`
+
+	// Name of the object.
+	Name string `json:"name"`
+
+	// Mode is the value of the tempo.grafana.com/reconcile annotation.
+	Mode ReconcileMode `json:"mode"`
+}
+
+// VolumeExpansionStatus describes a PersistentVolumeClaim of a StatefulSet which is being expanded.
+type VolumeExpansionStatus struct {
+	// StatefulSet is the name of the StatefulSet using the PersistentVolumeClaim.
+	StatefulSet string `json:"statefulSet"`
+
+	// Claim is the name of the PersistentVolumeClaim.
+	Claim string `json:"claim"`
+
+	// Requested is the requested storage size.
+	Requested resource.Quantity `json:"requested"`
+
+	// Capacity is the current storage size of the volume.
+	//
+	// +optional
+	// +kubebuilder:validation:Optional
+	Capacity resource.Quantity `json:"capacity,omitempty"`
+}
+
+// StaleRingInstance describes an ingester in the ring, whose pod does not exist.
+type StaleRingInstance struct {
+	// ID of the ring instance.
+	ID string `json:"id"`
+
+	// State of the ring instance.
+	State string `json:"state"`
+
+	// Since is the time when the pod of the ring instance was first found missing.
+	Since metav1.Time `json:"since"`
+}
+
+// ForgottenRingInstance describes an ingester which was removed from the ring by the operator.
+type ForgottenRingInstance struct {
+	// ID of the ring instance.
+	ID string `json:"id"`
+
+	// Time when the ring instance was removed from the ring.
+	Time metav1.Time `json:"time"`
+}
+
+// StatusSummary summarizes the ready and desired replicas of the main Tempo components, in the format "ready/desired".
+// A field is empty if the component is not deployed.
+type StatusSummary struct {
+	// Distributors are the ready and desired replicas of the distributor.
+	Distributors string `json:"distributors,omitempty"`
+
+	// Ingesters are the ready and desired replicas of the ingester, summed over all zones.
+	Ingesters string `json:"ingesters,omitempty"`
+
+	// Queriers are the ready and desired replicas of the querier.
+	Queriers string `json:"queriers,omitempty"`
+
+	// QueryFrontends are the ready and desired replicas of the query-frontend.
+	QueryFrontends string `json:"queryFrontends,omitempty"`
+
+	// Compactors are the ready and desired replicas of the compactor.
+	Compactors string `json:"compactors,omitempty"`
+
+	// MetricsGenerators are the ready and desired replicas of the metrics-generator.
+	MetricsGenerators string `json:"metricsGenerators,omitempty"`
+}
+
+// RingMember describes an ingester in the ingester ring.
+type RingMember struct {
+	// ID of the ingester in the ring.
+	ID string `json:"id"`
+
+	// State of the ingester in the ring (ACTIVE, JOINING, LEAVING or UNHEALTHY).
+	State string `json:"state"`
+
+	// Zone of the ingester, if zone awareness is enabled.
+	//
+	// +optional
+	Zone string `json:"zone,omitempty"`
+
+	// Tokens is the number of tokens owned by the ingester.
+	Tokens int32 `json:"tokens"`
+
+	// LastHeartbeat is the time of the last heartbeat of the ingester.
+	//
+	// +optional
+	LastHeartbeat *metav1.Time `json:"lastHeartbeat,omitempty"`
+}
+
+// DisruptiveChange defines the type of a change, which is applied only inside a maintenance window.
+//
+// +kubebuilder:validation:Enum=Recreation;CARotation;IngesterRestart;ChartUpgrade
+type DisruptiveChange string
+
+const (
+	// DisruptiveChangeRecreation is the deletion and re-creation of an object, because an immutable field changed.
+	DisruptiveChangeRecreation DisruptiveChange = "Recreation"
+	// DisruptiveChangeCARotation is the rotation of the CA certificate.
+	DisruptiveChangeCARotation DisruptiveChange = "CARotation"
+	// DisruptiveChangeIngesterRestart is a change of the pod template of an ingester StatefulSet, which restarts all ingesters.
+	DisruptiveChangeIngesterRestart DisruptiveChange = "IngesterRestart"
+	// DisruptiveChangeChartUpgrade is an upgrade of the helm chart version.
+	DisruptiveChangeChartUpgrade DisruptiveChange = "ChartUpgrade"
 )
 
+// DeferredChange describes a disruptive change, which will be applied in the next maintenance window.
+type DeferredChange struct {
+	// Kind of the object.
+	Kind string `json:"kind"`
+
+	// Name of the object.
+	Name string `json:"name"`
+
+	// Change describes the type of the disruptive change.
+	Change DisruptiveChange `json:"change"`
+}
+
 // TempoMicroservicesStatus defines the observed state of TempoMicroservices
 type TempoMicroservicesStatus struct {
 	// Components provides summary of all Tempo pod status, grouped per component.
+	// A component is listed for every Deployment and StatefulSet rendered by the helm chart.
 	//
 	// +kubebuilder:validation:Optional
-	Components ComponentStatus `json:"components,omitempty"`
+	// +listType=map
+	// +listMapKey=component
+	Components []ComponentStatus `json:"components,omitempty"`
 
 	// Conditions of the Tempo deployment health.
 	//
 	// +kubebuilder:validation:Optional
 	// +operator-sdk:csv:customresourcedefinitions:type=status,xDescriptors="urn:alm:descriptor:io.kubernetes.conditions"
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// PendingChanges lists the changes required to reconcile the managed objects,
+	// computed by a server-side dry-run if the management state is set to Preview.
+	//
+	// +kubebuilder:validation:Optional
+	PendingChanges []PendingChange `json:"pendingChanges,omitempty"`
+
+	// UserOwnedObjects lists the objects which are not updated by the operator,
+	// because of the tempo.grafana.com/reconcile annotation.
+	//
+	// +kubebuilder:validation:Optional
+	UserOwnedObjects []UserOwnedObject `json:"userOwnedObjects,omitempty"`
+
+	// VolumeExpansions lists the PersistentVolumeClaims which are being expanded.
+	//
+	// +kubebuilder:validation:Optional
+	VolumeExpansions []VolumeExpansionStatus `json:"volumeExpansions,omitempty"`
+
+	// StaleRingInstances lists the ingesters in the ring, whose pods do not exist.
+	// They are removed from the ring after the grace period of the ring cleanup.
+	//
+	// +kubebuilder:validation:Optional
+	StaleRingInstances []StaleRingInstance `json:"staleRingInstances,omitempty"`
+
+	// ForgottenRingInstances lists the ingesters most recently removed from the ring by the operator.
+	//
+	// +kubebuilder:validation:Optional
+	ForgottenRingInstances []ForgottenRingInstance `json:"forgottenRingInstances,omitempty"`
+
+	// DeferredChanges lists the disruptive changes, which will be applied in the next maintenance window.
+	//
+	// +kubebuilder:validation:Optional
+	DeferredChanges []DeferredChange `json:"deferredChanges,omitempty"`
+
+	// NextMaintenanceWindow is the start of the next maintenance window, if changes are deferred.
+	//
+	// +kubebuilder:validation:Optional
+	NextMaintenanceWindow *metav1.Time `json:"nextMaintenanceWindow,omitempty"`
+
+	// Ring lists the members of the ingester ring, as reported by the distributor.
+	//
+	// +kubebuilder:validation:Optional
+	Ring []RingMember `json:"ring,omitempty"`
+
+	// Summary summarizes the ready and desired replicas of the main Tempo components.
+	//
+	// +kubebuilder:validation:Optional
+	Summary StatusSummary `json:"summary,omitempty"`
+
+	// ObservedGeneration is the generation of the TempoMicroservices resource, which was processed by the last reconciliation.
+	//
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// ChartVersion is the version of the helm chart, which was applied by the last successful reconciliation.
+	//
+	// +kubebuilder:validation:Optional
+	ChartVersion string `json:"chartVersion,omitempty"`
+
+	// TempoVersion is the image tag of the Tempo components, which were applied by the last successful reconciliation.
+	// Multiple tags are separated by commas, if the image of a component is overridden.
+	//
+	// +kubebuilder:validation:Optional
+	TempoVersion string `json:"tempoVersion,omitempty"`
+
+	// ValuesHash is the hash of the helm values, which were applied by the last successful reconciliation.
+	//
+	// +kubebuilder:validation:Optional
+	ValuesHash string `json:"valuesHash,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Chart",type=string,JSONPath=`.status.chartVersion`
+//+kubebuilder:printcolumn:name="Tempo",type=string,JSONPath=`.status.tempoVersion`
+//+kubebuilder:printcolumn:name="Distributors",type=string,JSONPath=`.status.summary.distributors`
+//+kubebuilder:printcolumn:name="Ingesters",type=string,JSONPath=`.status.summary.ingesters`
+//+kubebuilder:printcolumn:name="Queriers",type=string,JSONPath=`.status.summary.queriers`
+//+kubebuilder:printcolumn:name="Query-Frontends",type=string,JSONPath=`.status.summary.queryFrontends`
+//+kubebuilder:printcolumn:name="Compactors",type=string,JSONPath=`.status.summary.compactors`
+//+kubebuilder:printcolumn:name="Metrics-Generators",type=string,JSONPath=`.status.summary.metricsGenerators`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // TempoMicroservices is the Schema for the tempomicroservices API
 type TempoMicroservices struct {
@@ -21,15 +21,16 @@ limitations under the License.
 package v1alpha1
 
 import (
-	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ComponentStatus) DeepCopyInto(out *ComponentStatus) {
 	*out = *in
-	if in.Compactor != nil {
-		in, out := &in.Compactor, &out.Compactor
+	if in.Pods != nil {
+		in, out := &in.Pods, &out.Pods
 		*out = make(PodStatusMap, len(*in))
 		for key, val := range *in {
 			var outVal []string
@@ -44,84 +45,38 @@ func (in *ComponentStatus) DeepCopyInto(out *ComponentStatus) {
 			(*out)[key] = outVal
 		}
 	}
-	if in.Distributor != nil {
-		in, out := &in.Distributor, &out.Distributor
-		*out = make(PodStatusMap, len(*in))
-		for key, val := range *in {
-			var outVal []string
-			if val == nil {
-				(*out)[key] = nil
-			} else {
-				inVal := (*in)[key]
-				in, out := &inVal, &outVal
-				*out = make([]string, len(*in))
-				copy(*out, *in)
-			}
-			(*out)[key] = outVal
-		}
-	}
-	if in.Ingester != nil {
-		in, out := &in.Ingester, &out.Ingester
-		*out = make(PodStatusMap, len(*in))
-		for key, val := range *in {
-			var outVal []string
-			if val == nil {
-				(*out)[key] = nil
-			} else {
-				inVal := (*in)[key]
-				in, out := &inVal, &outVal
-				*out = make([]string, len(*in))
-				copy(*out, *in)
-			}
-			(*out)[key] = outVal
-		}
-	}
-	if in.Querier != nil {
-		in, out := &in.Querier, &out.Querier
-		*out = make(PodStatusMap, len(*in))
-		for key, val := range *in {
-			var outVal []string
-			if val == nil {
-				(*out)[key] = nil
-			} else {
-				inVal := (*in)[key]
-				in, out := &inVal, &outVal
-				*out = make([]string, len(*in))
-				copy(*out, *in)
-			}
-			(*out)[key] = outVal
-		}
-	}
-	if in.QueryFrontend != nil {
-		in, out := &in.QueryFrontend, &out.QueryFrontend
-		*out = make(PodStatusMap, len(*in))
+	if in.Zones != nil {
+		in, out := &in.Zones, &out.Zones
+		*out = make(map[string]PodStatusMap, len(*in))
 		for key, val := range *in {
-			var outVal []string
+			var outVal map[v1.PodPhase][]string
 			if val == nil {
 				(*out)[key] = nil
 			} else {
 				inVal := (*in)[key]
 				in, out := &inVal, &outVal
-				*out = make([]string, len(*in))
-				copy(*out, *in)
+				*out = make(PodStatusMap, len(*in))
+				for key, val := range *in {
+					var outVal []string
+					if val == nil {
+						(*out)[key] = nil
+					} else {
+						inVal := (*in)[key]
+						in, out := &inVal, &outVal
+						*out = make([]string, len(*in))
+						copy(*out, *in)
+					}
+					(*out)[key] = outVal
+				}
 			}
 			(*out)[key] = outVal
 		}
 	}
-	if in.Observatorium != nil {
-		in, out := &in.Observatorium, &out.Observatorium
-		*out = make(PodStatusMap, len(*in))
-		for key, val := range *in {
-			var outVal []string
-			if val == nil {
-				(*out)[key] = nil
-			} else {
-				inVal := (*in)[key]
-				in, out := &inVal, &outVal
-				*out = make([]string, len(*in))
-				copy(*out, *in)
-			}
-			(*out)[key] = outVal
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
@@ -136,6 +91,88 @@ func (in *ComponentStatus) DeepCopy() *ComponentStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeferredChange) DeepCopyInto(out *DeferredChange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeferredChange.
+func (in *DeferredChange) DeepCopy() *DeferredChange {
+	if in == nil {
+		return nil
+	}
+	out := new(DeferredChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ForgottenRingInstance) DeepCopyInto(out *ForgottenRingInstance) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForgottenRingInstance.
+func (in *ForgottenRingInstance) DeepCopy() *ForgottenRingInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(ForgottenRingInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HealthProbesSpec) DeepCopyInto(out *HealthProbesSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HealthProbesSpec.
+func (in *HealthProbesSpec) DeepCopy() *HealthProbesSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HealthProbesSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PendingChange) DeepCopyInto(out *PendingChange) {
+	*out = *in
+	if in.Fields != nil {
+		in, out := &in.Fields, &out.Fields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PendingChange.
+func (in *PendingChange) DeepCopy() *PendingChange {
+	if in == nil {
+		return nil
+	}
+	out := new(PendingChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in PodStatusMap) DeepCopyInto(out *PodStatusMap) {
 	{
@@ -166,6 +203,102 @@ func (in PodStatusMap) DeepCopy() PodStatusMap {
 	return *out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PruningSpec) DeepCopyInto(out *PruningSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PruningSpec.
+func (in *PruningSpec) DeepCopy() *PruningSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PruningSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RingCleanupSpec) DeepCopyInto(out *RingCleanupSpec) {
+	*out = *in
+	out.GracePeriod = in.GracePeriod
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RingCleanupSpec.
+func (in *RingCleanupSpec) DeepCopy() *RingCleanupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RingCleanupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RingMember) DeepCopyInto(out *RingMember) {
+	*out = *in
+	if in.LastHeartbeat != nil {
+		in, out := &in.LastHeartbeat, &out.LastHeartbeat
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RingMember.
+func (in *RingMember) DeepCopy() *RingMember {
+	if in == nil {
+		return nil
+	}
+	out := new(RingMember)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaleRingInstance) DeepCopyInto(out *StaleRingInstance) {
+	*out = *in
+	in.Since.DeepCopyInto(&out.Since)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaleRingInstance.
+func (in *StaleRingInstance) DeepCopy() *StaleRingInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(StaleRingInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StatusSummary) DeepCopyInto(out *StatusSummary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StatusSummary.
+func (in *StatusSummary) DeepCopy() *StatusSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(StatusSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageProbeSpec) DeepCopyInto(out *StorageProbeSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageProbeSpec.
+func (in *StorageProbeSpec) DeepCopy() *StorageProbeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageProbeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TempoMicroservices) DeepCopyInto(out *TempoMicroservices) {
 	*out = *in
@@ -229,6 +362,21 @@ func (in *TempoMicroservicesList) DeepCopyObject() runtime.Object {
 func (in *TempoMicroservicesSpec) DeepCopyInto(out *TempoMicroservicesSpec) {
 	*out = *in
 	in.Values.DeepCopyInto(&out.Values)
+	out.Pruning = in.Pruning
+	if in.ReadinessGates != nil {
+		in, out := &in.ReadinessGates, &out.ReadinessGates
+		*out = make([]ReadinessGate, len(*in))
+		copy(*out, *in)
+	}
+	out.RingCleanup = in.RingCleanup
+	in.ZoneAwareness.DeepCopyInto(&out.ZoneAwareness)
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = make([]MaintenanceWindow, len(*in))
+		copy(*out, *in)
+	}
+	out.HealthProbes = in.HealthProbes
+	out.StorageProbe = in.StorageProbe
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TempoMicroservicesSpec.
@@ -244,14 +392,70 @@ func (in *TempoMicroservicesSpec) DeepCopy() *TempoMicroservicesSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TempoMicroservicesStatus) DeepCopyInto(out *TempoMicroservicesStatus) {
 	*out = *in
-	in.Components.DeepCopyInto(&out.Components)
+	if in.Components != nil {
+		in, out := &in.Components, &out.Components
+		*out = make([]ComponentStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
-		*out = make([]v1.Condition, len(*in))
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PendingChanges != nil {
+		in, out := &in.PendingChanges, &out.PendingChanges
+		*out = make([]PendingChange, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.UserOwnedObjects != nil {
+		in, out := &in.UserOwnedObjects, &out.UserOwnedObjects
+		*out = make([]UserOwnedObject, len(*in))
+		copy(*out, *in)
+	}
+	if in.VolumeExpansions != nil {
+		in, out := &in.VolumeExpansions, &out.VolumeExpansions
+		*out = make([]VolumeExpansionStatus, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.StaleRingInstances != nil {
+		in, out := &in.StaleRingInstances, &out.StaleRingInstances
+		*out = make([]StaleRingInstance, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ForgottenRingInstances != nil {
+		in, out := &in.ForgottenRingInstances, &out.ForgottenRingInstances
+		*out = make([]ForgottenRingInstance, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DeferredChanges != nil {
+		in, out := &in.DeferredChanges, &out.DeferredChanges
+		*out = make([]DeferredChange, len(*in))
+		copy(*out, *in)
+	}
+	if in.NextMaintenanceWindow != nil {
+		in, out := &in.NextMaintenanceWindow, &out.NextMaintenanceWindow
+		*out = (*in).DeepCopy()
+	}
+	if in.Ring != nil {
+		in, out := &in.Ring, &out.Ring
+		*out = make([]RingMember, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	out.Summary = in.Summary
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TempoMicroservicesStatus.
@@ -263,3 +467,55 @@ func (in *TempoMicroservicesStatus) DeepCopy() *TempoMicroservicesStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UserOwnedObject) DeepCopyInto(out *UserOwnedObject) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UserOwnedObject.
+func (in *UserOwnedObject) DeepCopy() *UserOwnedObject {
+	if in == nil {
+		return nil
+	}
+	out := new(UserOwnedObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeExpansionStatus) DeepCopyInto(out *VolumeExpansionStatus) {
+	*out = *in
+	out.Requested = in.Requested.DeepCopy()
+	out.Capacity = in.Capacity.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeExpansionStatus.
+func (in *VolumeExpansionStatus) DeepCopy() *VolumeExpansionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeExpansionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZoneAwarenessSpec) DeepCopyInto(out *ZoneAwarenessSpec) {
+	*out = *in
+	if in.Zones != nil {
+		in, out := &in.Zones, &out.Zones
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZoneAwarenessSpec.
+func (in *ZoneAwarenessSpec) DeepCopy() *ZoneAwarenessSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ZoneAwarenessSpec)
+	in.DeepCopyInto(out)
+	return out
+}
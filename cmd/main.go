@@ -142,6 +142,7 @@ func main() {
 		Scheme:             mgr.GetScheme(),
 		ActionConfigGetter: actionConfigGetter,
 		ActionClientGetter: actionClientGetter,
+		Recorder:           mgr.GetEventRecorderFor("tempo-helm-operator"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "TempoMicroservices")
 		os.Exit(1)
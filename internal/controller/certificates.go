@@ -3,6 +3,7 @@ package controller
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"fmt"
@@ -10,151 +11,284 @@ import (
 
 	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
 	"github.com/openshift/library-go/pkg/crypto"
+	"helm.sh/helm/v3/pkg/chartutil"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 var defaultUserInfo = &user.DefaultInfo{Name: "system:tempostacks", Groups: []string{"system:logging"}}
 
-func createCerts(ctx context.Context, k8sclient client.Client, tempo v1alpha1.TempoMicroservices) ([]client.Object, error) {
+// issuedCertificate is a certificate issued by createCerts.
+// The event for an issued certificate is emitted once the certificate is applied, see recordIssuedCertificates.
+type issuedCertificate struct {
+	secret      *corev1.Secret
+	cert        []byte
+	description string
+	rotated     bool
+}
+
+// createCerts returns the Secrets containing the CA certificate and the certificates of the components,
+// and the certificates which are issued, because they are missing or expiring.
+// While an expiring CA certificate is rotated, the new CA certificate is also stored in a pending Secret, see createCA.
+func createCerts(ctx context.Context, k8sclient client.Client, tempo v1alpha1.TempoMicroservices) ([]client.Object, []issuedCertificate, error) {
 	manifests := []client.Object{}
+	issued := []issuedCertificate{}
 
-	caSecret, err := createCA(ctx, k8sclient, tempo.GetNamespace(), fmt.Sprintf("%s-tempo-ca-cert", tempo.GetName()))
+	caSecret, pendingSecret, caIssued, err := createCA(ctx, k8sclient, &tempo, fmt.Sprintf("%s-tempo-ca-cert", tempo.GetName()))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	manifests = append(manifests, caSecret)
+	if pendingSecret != nil {
+		manifests = append(manifests, pendingSecret)
+	}
+	if caIssued != nil {
+		issued = append(issued, *caIssued)
+	}
 
 	ca, err := crypto.GetCAFromBytes(caSecret.Data[corev1.TLSCertKey], caSecret.Data[corev1.TLSPrivateKeyKey])
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	caCertBytes := caSecret.Data[corev1.TLSCertKey]
 	for _, component := range []string{"compactor", "distributor", "ingester", "querier", "query-frontend", "observatorium"} {
 		name := fmt.Sprintf("%s-tempo-%s-certs", tempo.GetName(), component)
 		hostnames := []string{fmt.Sprintf("%s-tempo-%s", tempo.GetName(), component)}
-		componentSecret, err := createServerCert(ctx, k8sclient, tempo.GetNamespace(), name, ca, caCertBytes, defaultUserInfo, hostnames)
+		componentSecret, certIssued, err := createServerCert(ctx, k8sclient, &tempo, name, ca, caCertBytes, defaultUserInfo, hostnames)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		manifests = append(manifests, componentSecret)
+		if certIssued != nil {
+			issued = append(issued, *certIssued)
+		}
 	}
-	return manifests, nil
+	return manifests, issued, nil
 }
 
-func createCA(ctx context.Context, k8sclient client.Client, namespace, name string) (*corev1.Secret, error) {
-	secret := &corev1.Secret{}
-	err := k8sclient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret)
-	if err != nil {
-		if apierrors.IsNotFound(err) {
-			secret = &corev1.Secret{
-				TypeMeta: metav1.TypeMeta{
-					APIVersion: corev1.SchemeGroupVersion.String(),
-					Kind:       "Secret",
-				},
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      name,
-					Namespace: namespace,
-				},
-				Data: map[string][]byte{},
-			}
-		} else {
-			return nil, err
-		}
+// createCA returns the Secret containing the CA certificate. A missing or expiring CA certificate is issued.
+// The CA certificate replacing an expiring CA certificate is also returned in a pending Secret (<name>-pending),
+// which is applied immediately and reused by subsequent reconciles, while the rotation is deferred until the next maintenance window.
+func createCA(ctx context.Context, k8sclient client.Client, owner *v1alpha1.TempoMicroservices, name string) (*corev1.Secret, *corev1.Secret, *issuedCertificate, error) {
+	log := log.FromContext(ctx).WithValues("secret", name)
+	namespace := owner.GetNamespace()
+	live := &corev1.Secret{}
+	err := k8sclient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, live)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, nil, nil, err
 	}
+	secret := newCertSecret(name, namespace, live.Data)
 
 	_, ok := secret.Data[corev1.TLSCertKey]
-	expired := false // TODO: check if cert is expired
+	expired := ok && certificateExpiring(secret.Data[corev1.TLSCertKey], time.Now())
+	if ok && !expired {
+		log.V(1).Info("CA certificate is valid")
+		return secret, nil, nil, nil
+	}
+
+	pendingName := fmt.Sprintf("%s-pending", name)
+	pending := &corev1.Secret{}
+	err = k8sclient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: pendingName}, pending)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, nil, nil, err
+	}
 
-	if !ok || expired {
-		fmt.Printf("CA cert expired\n")
+	// a pending CA certificate which equals the current CA certificate is left over from the previous rotation, and is not reused
+	pendingCert := pending.Data[corev1.TLSCertKey]
+	if expired && len(pendingCert) > 0 && len(pending.Data[corev1.TLSPrivateKeyKey]) > 0 &&
+		!certificateExpiring(pendingCert, time.Now()) && !bytes.Equal(pendingCert, secret.Data[corev1.TLSCertKey]) {
+		log.V(1).Info("reusing pending CA certificate")
+		secret.Data[corev1.TLSCertKey] = pendingCert
+		secret.Data[corev1.TLSPrivateKeyKey] = pending.Data[corev1.TLSPrivateKeyKey]
+	} else {
+		log.Info("issuing CA certificate")
 		caCfg, err := crypto.MakeSelfSignedCAConfigForDuration("operator", 10*time.Hour)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 
 		certBytes := &bytes.Buffer{}
 		keyBytes := &bytes.Buffer{}
 		err = caCfg.WriteCertConfig(certBytes, keyBytes)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 
 		secret.Data[corev1.TLSCertKey] = certBytes.Bytes()
 		secret.Data[corev1.TLSPrivateKeyKey] = keyBytes.Bytes()
-	} else {
-		fmt.Printf("CA cert not expired\n")
 	}
 
-	return secret, nil
+	issued := &issuedCertificate{secret: secret, cert: secret.Data[corev1.TLSCertKey], description: "CA certificate", rotated: expired}
+	if !expired {
+		return secret, nil, issued, nil
+	}
+	return secret, newCertSecret(pendingName, namespace, secret.Data), issued, nil
 }
 
-func createServerCert(ctx context.Context, k8sclient client.Client, namespace, name string, ca *crypto.CA, caCertBytes []byte, user user.Info, hostnames []string) (*corev1.Secret, error) {
-	secret := &corev1.Secret{}
-	err := k8sclient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret)
-	if err != nil {
-		if apierrors.IsNotFound(err) {
-			secret = &corev1.Secret{
-				TypeMeta: metav1.TypeMeta{
-					APIVersion: corev1.SchemeGroupVersion.String(),
-					Kind:       "Secret",
-				},
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      name,
-					Namespace: namespace,
-				},
-				Data: map[string][]byte{},
-			}
-		} else {
-			return nil, err
-		}
+func createServerCert(ctx context.Context, k8sclient client.Client, owner *v1alpha1.TempoMicroservices, name string, ca *crypto.CA, caCertBytes []byte, user user.Info, hostnames []string) (*corev1.Secret, *issuedCertificate, error) {
+	log := log.FromContext(ctx).WithValues("secret", name)
+	namespace := owner.GetNamespace()
+	live := &corev1.Secret{}
+	err := k8sclient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, live)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, nil, err
 	}
+	secret := newCertSecret(name, namespace, live.Data)
 
 	_, ok := secret.Data[corev1.TLSCertKey]
-	expired := false // TODO: check if cert is expired
+	expired := ok && certificateExpiring(secret.Data[corev1.TLSCertKey], time.Now())
+	// the certificate must be re-issued if the CA certificate was rotated
+	signedByCA := bytes.Equal(secret.Data["ca.crt"], caCertBytes)
+
+	if ok && !expired && signedByCA {
+		log.V(1).Info("certificate is valid", "hostname", hostnames[0])
+		return secret, nil, nil
+	}
+
+	log.Info("issuing certificate", "hostname", hostnames[0])
 
-	if !ok || expired {
-		fmt.Printf("%s cert expired\n", hostnames[0])
+	addClientAuthUsage := func(cert *x509.Certificate) error {
+		cert.ExtKeyUsage = append(cert.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+		return nil
+	}
 
-		addClientAuthUsage := func(cert *x509.Certificate) error {
-			cert.ExtKeyUsage = append(cert.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
-			return nil
+	addSubject := func(cert *x509.Certificate) error {
+		cert.Subject = pkix.Name{
+			CommonName:   user.GetName(),
+			SerialNumber: user.GetUID(),
+			Organization: user.GetGroups(),
 		}
+		return nil
+	}
 
-		addSubject := func(cert *x509.Certificate) error {
-			cert.Subject = pkix.Name{
-				CommonName:   user.GetName(),
-				SerialNumber: user.GetUID(),
-				Organization: user.GetGroups(),
-			}
-			return nil
+	tlsCfg, err := ca.MakeServerCertForDuration(sets.NewString(hostnames...), 10*time.Hour, addClientAuthUsage, addSubject)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBytes := &bytes.Buffer{}
+	keyBytes := &bytes.Buffer{}
+	err = tlsCfg.WriteCertConfig(certBytes, keyBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secret.Data[corev1.TLSCertKey] = certBytes.Bytes()
+	secret.Data[corev1.TLSPrivateKeyKey] = keyBytes.Bytes()
+	secret.Data["ca.crt"] = caCertBytes
+	return secret, &issuedCertificate{
+		secret:      secret,
+		cert:        secret.Data[corev1.TLSCertKey],
+		description: fmt.Sprintf("certificate for %s", hostnames[0]),
+		rotated:     ok,
+	}, nil
+}
+
+// certificateExpiring checks if a PEM encoded certificate must be renewed, because more than 80% of its validity period elapsed.
+// Certificates which cannot be parsed are renewed as well.
+func certificateExpiring(certPEM []byte, now time.Time) bool {
+	certs, err := crypto.CertsFromPEM(certPEM)
+	if err != nil || len(certs) == 0 {
+		return true
+	}
+
+	cert := certs[0]
+	validity := cert.NotAfter.Sub(cert.NotBefore)
+	renewAt := cert.NotBefore.Add(validity * 4 / 5)
+	return !now.Before(renewAt)
+}
+
+// certificateValidUntil checks if a PEM encoded certificate is still valid at the given time.
+// Certificates which cannot be parsed are never valid.
+func certificateValidUntil(certPEM []byte, t time.Time) bool {
+	certs, err := crypto.CertsFromPEM(certPEM)
+	if err != nil || len(certs) == 0 {
+		return false
+	}
+	return certs[0].NotAfter.After(t)
+}
+
+// newCertSecret returns a Secret containing a copy of the certificate data of the live Secret.
+// The metadata populated by the API server is not copied, because it is not part of the desired state.
+func newCertSecret(name string, namespace string, liveData map[string][]byte) *corev1.Secret {
+	data := map[string][]byte{}
+	for key, value := range liveData {
+		data[key] = value
+	}
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Data: data,
+	}
+}
+
+// recordIssuedCertificates emits an event for each issued certificate, which was applied by reconcileManagedObjects.
+// Certificates which were not applied, e.g. because the CA rotation is deferred until the next maintenance window
+// or the Secret is opted-out of reconciliation, are skipped.
+func recordIssuedCertificates(recorder record.EventRecorder, owner *v1alpha1.TempoMicroservices, manifests []client.Object, issued []issuedCertificate) {
+	applied := sets.New[client.Object](manifests...)
+	for _, cert := range issued {
+		// the Secret is updated with the response of the API server when it is applied
+		if !applied.Has(cert.secret) || cert.secret.GetResourceVersion() == "" || !bytes.Equal(cert.secret.Data[corev1.TLSCertKey], cert.cert) {
+			continue
 		}
 
-		tlsCfg, err := ca.MakeServerCertForDuration(sets.NewString(hostnames...), 10*time.Hour, addClientAuthUsage, addSubject)
-		if err != nil {
-			return nil, err
+		if cert.rotated {
+			recorder.Eventf(owner, corev1.EventTypeNormal, "CertificateRotated", "Rotated %s in secret %s", cert.description, cert.secret.Name)
+		} else {
+			recorder.Eventf(owner, corev1.EventTypeNormal, "CertificateIssued", "Issued %s in secret %s", cert.description, cert.secret.Name)
 		}
+	}
+}
 
-		certBytes := &bytes.Buffer{}
-		keyBytes := &bytes.Buffer{}
-		err = tlsCfg.WriteCertConfig(certBytes, keyBytes)
-		if err != nil {
-			return nil, err
+// componentTLSConfig returns the TLS configuration for connecting to the HTTP API of a component, or nil if TLS is disabled.
+// The certificate of the component, as created by createCerts, is used as client certificate to support mTLS.
+func componentTLSConfig(tempo v1alpha1.TempoMicroservices, vals chartutil.Values, manifests []client.Object, component string) (*tls.Config, error) {
+	tlsEnabled, _ := vals.PathValue("server.tls.enabled")
+	if tlsEnabled != true {
+		return nil, nil
+	}
+
+	name := fmt.Sprintf("%s-tempo-%s-certs", tempo.GetName(), component)
+	var secret *corev1.Secret
+	for _, obj := range manifests {
+		if s, ok := obj.(*corev1.Secret); ok && s.Name == name {
+			secret = s
 		}
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("secret %s not found", name)
+	}
 
-		secret.Data[corev1.TLSCertKey] = certBytes.Bytes()
-		secret.Data[corev1.TLSPrivateKeyKey] = keyBytes.Bytes()
-		secret.Data["ca.crt"] = caCertBytes
-	} else {
-		fmt.Printf("%s cert not expired\n", hostnames[0])
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, err
+	}
+
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(secret.Data["ca.crt"]) {
+		return nil, fmt.Errorf("cannot parse CA certificate of secret %s", secret.Name)
 	}
 
-	return secret, nil
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      rootCAs,
+		ServerName:   fmt.Sprintf("%s-tempo-%s", tempo.GetName(), component),
+		MinVersion:   tls.VersionTLS12,
+	}, nil
 }
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+func TestCreateCertsIssued(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	tempo := v1alpha1.TempoMicroservices{ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "default"}}
+
+	// returns the created Secrets and the issued certificates
+	createCerts := func(objects ...client.Object) ([]client.Object, []issuedCertificate) {
+		k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build()
+		secrets, issued, err := createCerts(ctx, k8sclient, tempo)
+		g.Expect(err).NotTo(HaveOccurred())
+		return secrets, issued
+	}
+	rotated := func(issued []issuedCertificate) []bool {
+		rotated := []bool{}
+		for _, cert := range issued {
+			rotated = append(rotated, cert.rotated)
+		}
+		return rotated
+	}
+
+	// new certificates are issued
+	secrets, issued := createCerts()
+	g.Expect(secrets).To(HaveLen(7))
+	g.Expect(issued).To(HaveLen(7))
+	g.Expect(rotated(issued)).To(HaveEach(BeFalse()))
+
+	// valid certificates are kept
+	_, issued = createCerts(secrets...)
+	g.Expect(issued).To(BeEmpty())
+
+	// a missing certificate is issued
+	missing := secrets[1].DeepCopyObject().(*corev1.Secret)
+	delete(missing.Data, corev1.TLSCertKey)
+	_, issued = createCerts(secrets[0], missing)
+	g.Expect(issued).To(HaveLen(6))
+	g.Expect(rotated(issued)).To(HaveEach(BeFalse()))
+
+	// an expiring CA certificate and all certificates signed by it are rotated
+	expiring := secrets[0].DeepCopyObject().(*corev1.Secret)
+	expiring.Data[corev1.TLSCertKey] = newTestCACert(t, time.Second)
+	time.Sleep(time.Second)
+	_, issued = createCerts(append([]client.Object{expiring}, secrets[1:]...)...)
+	g.Expect(issued).To(HaveLen(7))
+	g.Expect(rotated(issued)).To(HaveEach(BeTrue()))
+}
+
+func TestRecordIssuedCertificates(t *testing.T) {
+	ctx := context.Background()
+	owner := &v1alpha1.TempoMicroservices{ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "default", UID: "owner-uid"}}
+	ownerScheme := runtime.NewScheme()
+	if err := scheme.AddToScheme(ownerScheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(ownerScheme); err != nil {
+		t.Fatal(err)
+	}
+
+	// returns the events emitted after applying the rendered Secrets
+	apply := func(t *testing.T, live []client.Object, render func([]client.Object) []client.Object) []string {
+		g := NewWithT(t)
+		k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(live...).Build()
+		secrets, issued, err := createCerts(ctx, k8sclient, *owner)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		manifests := render(secrets)
+		recorder := record.NewFakeRecorder(100)
+		_, _, err = reconcileManagedObjects(ctx, k8sclient, owner, ownerScheme, record.NewFakeRecorder(100), manifests, map[types.UID]client.Object{})
+		g.Expect(err).NotTo(HaveOccurred())
+		recordIssuedCertificates(recorder, owner, manifests, issued)
+
+		close(recorder.Events)
+		events := []string{}
+		for event := range recorder.Events {
+			events = append(events, event)
+		}
+		return events
+	}
+	all := func(secrets []client.Object) []client.Object { return secrets }
+
+	k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	valid, _, err := createCerts(ctx, k8sclient, *owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("issued", func(t *testing.T) {
+		g := NewWithT(t)
+		events := apply(t, nil, all)
+		g.Expect(events).To(HaveLen(7))
+		g.Expect(events).To(HaveEach(HavePrefix("Normal CertificateIssued")))
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(apply(t, valid, all)).To(BeEmpty())
+	})
+
+	t.Run("rotated", func(t *testing.T) {
+		g := NewWithT(t)
+		live := []client.Object{}
+		for _, secret := range valid {
+			live = append(live, secret.DeepCopyObject().(client.Object))
+		}
+		live[0].(*corev1.Secret).Data[corev1.TLSCertKey] = newTestCACert(t, time.Second)
+		time.Sleep(time.Second)
+
+		events := apply(t, live, all)
+		g.Expect(events).To(HaveLen(7))
+		g.Expect(events).To(HaveEach(HavePrefix("Normal CertificateRotated")))
+	})
+
+	t.Run("not applied", func(t *testing.T) {
+		g := NewWithT(t)
+		// e.g. the rotation is deferred until the next maintenance window
+		events := apply(t, nil, func(secrets []client.Object) []client.Object { return secrets[:1] })
+		g.Expect(events).To(ConsistOf(HavePrefix("Normal CertificateIssued Issued CA certificate")))
+	})
+
+	t.Run("opted-out of reconciliation", func(t *testing.T) {
+		g := NewWithT(t)
+		skipped := valid[1].DeepCopyObject().(*corev1.Secret)
+		skipped.Annotations = map[string]string{v1alpha1.ReconcileAnnotation: string(v1alpha1.ReconcileModeSkip)}
+		delete(skipped.Data, corev1.TLSCertKey)
+
+		live := append([]client.Object{valid[0], skipped}, valid[2:]...)
+		g.Expect(apply(t, live, all)).To(BeEmpty())
+	})
+}
+
+func TestCreateCertsPendingCA(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	tempo := v1alpha1.TempoMicroservices{ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "default"}}
+
+	k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	secrets, _, err := createCerts(ctx, k8sclient, tempo)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(secrets).To(HaveLen(7))
+
+	// the CA certificate expires, the rotated CA certificate is stored in the pending Secret
+	expiring := secrets[0].DeepCopyObject().(*corev1.Secret)
+	expiring.Data[corev1.TLSCertKey] = newTestCACert(t, time.Second)
+	time.Sleep(time.Second)
+	k8sclient = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(append([]client.Object{expiring}, secrets[1:]...)...).Build()
+	rotated, _, err := createCerts(ctx, k8sclient, tempo)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rotated).To(HaveLen(8))
+	pending := rotated[1].(*corev1.Secret)
+	g.Expect(pending.Name).To(Equal("simplest-tempo-ca-cert-pending"))
+	g.Expect(pending.Data).To(Equal(rotated[0].(*corev1.Secret).Data))
+
+	// while the rotation is deferred, the pending CA certificate is reused
+	g.Expect(k8sclient.Create(ctx, pending)).To(Succeed())
+	reused, _, err := createCerts(ctx, k8sclient, tempo)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(reused[0].(*corev1.Secret).Data).To(Equal(pending.Data))
+
+	// after the rotation, the pending Secret equals the CA certificate, and is not rendered anymore
+	k8sclient = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(rotated[0], pending).Build()
+	applied, _, err := createCerts(ctx, k8sclient, tempo)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(applied).To(HaveLen(7))
+	g.Expect(applied[0].(*corev1.Secret).Data).To(Equal(pending.Data))
+}
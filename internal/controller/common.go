@@ -4,16 +4,30 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
 )
 
 func isNamespaceScoped(obj client.Object) bool {
@@ -25,63 +39,259 @@ func isNamespaceScoped(obj client.Object) bool {
 	}
 }
 
+// ownedTypes returns the types which are watched by default, and can be owned by a TempoMicroservices instance.
+func ownedTypes() []client.Object {
+	return []client.Object{
+		&corev1.ConfigMap{},
+		&corev1.Secret{},
+		&corev1.Service{},
+		&corev1.ServiceAccount{},
+		&appsv1.Deployment{},
+		&appsv1.StatefulSet{},
+		&networkingv1.Ingress{},
+	}
+}
+
+// ownedKinds returns the kinds which can be owned by a TempoMicroservices instance: the default owned types,
+// the kinds rendered by the helm chart and all kinds watched since the operator started.
+func (r *TempoMicroservicesReconciler) ownedKinds(manifests []client.Object) ([]schema.GroupVersionKind, error) {
+	kinds := sets.New[schema.GroupVersionKind]()
+	for _, obj := range append(ownedTypes(), manifests...) {
+		gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+		if err != nil {
+			return nil, err
+		}
+		kinds.Insert(gvk)
+	}
+
+	r.watchesMu.Lock()
+	defer r.watchesMu.Unlock()
+	kinds = kinds.Union(r.watches)
+
+	sorted := kinds.UnsortedList()
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].String() < sorted[j].String() })
+	return sorted, nil
+}
+
+// getOwnedObjects returns all objects of the given kinds which are owned by the owner: namespaced objects in the namespace
+// of the owner which are controlled by the owner, and cluster-scoped objects with the owner labels of the owner.
+// Kinds whose API is not available in the cluster are skipped.
+func getOwnedObjects(ctx context.Context, k8sclient client.Client, owner metav1.Object, kinds []schema.GroupVersionKind) (map[types.UID]client.Object, error) {
+	ownedObjects := map[types.UID]client.Object{}
+	for _, gvk := range kinds {
+		mapping, err := k8sclient.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if namespaced {
+			err = k8sclient.List(ctx, list, client.InNamespace(owner.GetNamespace()))
+		} else {
+			err = k8sclient.List(ctx, list, client.MatchingLabels{
+				ownerNameLabel:      owner.GetName(),
+				ownerNamespaceLabel: owner.GetNamespace(),
+			})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error listing owned objects: %w", err)
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			if !namespaced || metav1.IsControlledBy(obj, owner) {
+				ownedObjects[obj.GetUID()] = obj
+			}
+		}
+	}
+	return ownedObjects, nil
+}
+
+// reconcileModeOf returns the reconcile mode of a live object, configured by the tempo.grafana.com/reconcile annotation.
+func reconcileModeOf(obj client.Object) v1alpha1.ReconcileMode {
+	return v1alpha1.ReconcileMode(obj.GetAnnotations()[v1alpha1.ReconcileAnnotation])
+}
+
+// getUserOwnedObject returns the live object if it exists and is opted-out of updates by the tempo.grafana.com/reconcile annotation,
+// otherwise nil.
+func getUserOwnedObject(ctx context.Context, k8sclient client.Client, obj client.Object) (client.Object, error) {
+	live := obj.DeepCopyObject().(client.Object)
+	err := k8sclient.Get(ctx, client.ObjectKeyFromObject(obj), live)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	switch reconcileModeOf(live) {
+	case v1alpha1.ReconcileModeSkip, v1alpha1.ReconcileModeCreateOnly:
+		return live, nil
+	default:
+		return nil, nil
+	}
+}
+
 // reconcileManagedObjects creates or updates all managed objects.
+// The objects are applied in phases (see applyPhase), if a readiness gate is configured for a phase,
+// the next phase is only applied once all workloads of this phase are ready.
 // If immutable fields are changed, the object will be deleted and re-created.
+// Changes to objects made outside the operator are reverted and recorded as drift.
+// Objects opted-out of reconciliation by the tempo.grafana.com/reconcile annotation are neither modified nor pruned,
+// and returned as user-owned objects. On error, the user-owned objects found so far are returned.
+// Returns false if a readiness gate holds back the remaining phases, i.e. not all objects were applied.
 func reconcileManagedObjects(
 	ctx context.Context,
 	k8sclient client.Client,
-	owner metav1.Object,
+	owner *v1alpha1.TempoMicroservices,
 	scheme *runtime.Scheme,
+	recorder record.EventRecorder,
 	managedObjects []client.Object,
 	ownedObjects map[types.UID]client.Object,
-) error {
+) ([]v1alpha1.UserOwnedObject, bool, error) {
 	log := log.FromContext(ctx)
 	pruneObjects := ownedObjects
+	userOwnedObjects := []v1alpha1.UserOwnedObject{}
 
 	// Create or update all objects managed by the operator
-	errs := []error{}
-	for _, obj := range managedObjects {
-		l := log.WithValues(
-			"objectName", obj.GetName(),
-			"objectKind", obj.GetObjectKind().GroupVersionKind(),
-		)
+	for _, phaseObjects := range groupByApplyPhase(managedObjects) {
+		phase := applyPhaseOf(phaseObjects[0])
+		appliedObjects := []client.Object{}
+
+		errs := []error{}
+		for _, obj := range phaseObjects {
+			l := log.WithValues(
+				"objectName", obj.GetName(),
+				"objectKind", obj.GetObjectKind().GroupVersionKind(),
+			)
 
-		if isNamespaceScoped(obj) {
-			if err := ctrl.SetControllerReference(owner, obj, scheme); err != nil {
-				l.Error(err, "failed to set controller owner reference to resource")
+			if isNamespaceScoped(obj) {
+				if err := ctrl.SetControllerReference(owner, obj, scheme); err != nil {
+					l.Error(err, "failed to set controller owner reference to resource")
+					errs = append(errs, err)
+					continue
+				}
+			} else {
+				setOwnerLabels(owner, obj)
+			}
+
+			userOwned, err := getUserOwnedObject(ctx, k8sclient, obj)
+			if err != nil {
+				l.Error(err, "failed to get resource")
 				errs = append(errs, err)
 				continue
 			}
-		}
+			if userOwned != nil {
+				l.V(1).Info("skipping resource opted-out of reconciliation", "mode", reconcileModeOf(userOwned))
+				userOwnedObjects = append(userOwnedObjects, v1alpha1.UserOwnedObject{
+					Kind: objectKind(obj, scheme),
+					Name: obj.GetName(),
+					Mode: reconcileModeOf(userOwned),
+				})
+				delete(pruneObjects, userOwned.GetUID())
+				continue
+			}
 
-		desired := obj.DeepCopyObject().(client.Object)
-		mutateFn := MutateFuncFor(obj, desired)
+			desiredHash, err := setAppliedHash(obj)
+			if err != nil {
+				l.Error(err, "failed to compute hash of resource")
+				errs = append(errs, err)
+				continue
+			}
 
-		var op controllerutil.OperationResult
-		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-			var err error
-			op, err = ctrl.CreateOrUpdate(ctx, k8sclient, obj, mutateFn)
-			return err
-		})
+			desired := obj.DeepCopyObject().(client.Object)
+			mutateFn := MutateFuncFor(obj, desired)
 
-		var immutableErr *ImmutableErr
-		if err != nil && errors.As(err, &immutableErr) {
-			l.Error(err, "detected a change in an immutable field. The object will be deleted, and re-created on next reconcile", "obj", obj.GetName())
-			err = k8sclient.Delete(ctx, desired)
-		}
+			// keep a copy of the live object, to detect changes made outside the operator
+			var existing client.Object
+			recordingMutateFn := func() error {
+				existing = obj.DeepCopyObject().(client.Object)
+				return mutateFn()
+			}
 
-		if err != nil {
-			l.Error(err, "failed to configure resource")
-			errs = append(errs, err)
-		} else {
-			l.V(1).Info(fmt.Sprintf("resource has been %s", op))
+			var op controllerutil.OperationResult
+			err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+				var err error
+				op, err = ctrl.CreateOrUpdate(ctx, k8sclient, obj, recordingMutateFn)
+				return err
+			})
+
+			if err == nil && op == controllerutil.OperationResultCreated {
+				recorder.Eventf(owner, corev1.EventTypeNormal, "Created", "Created %s %s", objectKind(obj, scheme), obj.GetName())
+			}
+			if err == nil && op == controllerutil.OperationResultUpdated {
+				drift, err := detectDrift(existing, obj, desiredHash)
+				if err != nil {
+					l.Error(err, "failed to detect drift of resource")
+				} else if len(drift) > 0 {
+					l.Info("reverted changes made outside the operator", "fields", drift)
+					recordDrift(recorder, owner, scheme, obj, drift)
+				}
+			}
+
+			var immutableErr *ImmutableErr
+			if err != nil && errors.As(err, &immutableErr) {
+				dpl, isDeployment := desired.(*appsv1.Deployment)
+				sts, isStatefulSet := desired.(*appsv1.StatefulSet)
+
+				expanded := false
+				if isStatefulSet && immutableErr.field == ".spec.volumeClaimTemplates" {
+					expanded, err = expandStatefulSetVolumes(ctx, k8sclient, sts)
+				}
+
+				switch {
+				case expanded:
+					l.Info("expanded volumes online. The statefulset will be re-created on next reconcile", "obj", obj.GetName())
+				case isStatefulSet && err != nil && !errors.As(err, &immutableErr):
+					// expanding the volumes failed
+				case isDeployment && owner.Spec.SelectorChangeStrategy == v1alpha1.SelectorChangeStrategyRecreate:
+					l.Info("detected a change of the label selector. The deployment will be re-created once a temporary deployment is ready", "obj", obj.GetName())
+					recordRecreation(recorder, owner, scheme, obj, immutableErr.field)
+					err = recreateDeployment(ctx, k8sclient, dpl, pruneObjects)
+				case isStatefulSet:
+					l.Info("detected a change in an immutable field. The statefulset will be deleted without its pods, and re-created on next reconcile", "obj", obj.GetName(), "field", immutableErr.field)
+					recordRecreation(recorder, owner, scheme, obj, immutableErr.field)
+					err = recreateStatefulSet(ctx, k8sclient, sts)
+				default:
+					l.Error(err, "detected a change in an immutable field. The object will be deleted, and re-created on next reconcile", "obj", obj.GetName())
+					recordRecreation(recorder, owner, scheme, obj, immutableErr.field)
+					err = k8sclient.Delete(ctx, desired)
+				}
+			} else if dpl, isDeployment := obj.(*appsv1.Deployment); err == nil && isDeployment {
+				err = cleanupTemporaryDeployment(ctx, k8sclient, dpl, pruneObjects)
+			} else if sts, isStatefulSet := obj.(*appsv1.StatefulSet); err == nil && isStatefulSet {
+				err = replaceOrphanedPods(ctx, k8sclient, sts)
+			}
+
+			if err != nil {
+				l.Error(err, "failed to configure resource")
+				errs = append(errs, err)
+			} else {
+				l.V(1).Info(fmt.Sprintf("resource has been %s", op))
+				appliedObjects = append(appliedObjects, obj)
+			}
+
+			// This object is still managed by the operator, remove it from the list of objects to prune
+			delete(pruneObjects, obj.GetUID())
+		}
+		if len(errs) > 0 {
+			return userOwnedObjects, false, fmt.Errorf("failed to create objects for %s: %w", owner.GetName(), errors.Join(errs...))
 		}
 
-		// This object is still managed by the operator, remove it from the list of objects to prune
-		delete(pruneObjects, obj.GetUID())
-	}
-	if len(errs) > 0 {
-		return fmt.Errorf("failed to create objects for %s: %w", owner.GetName(), errors.Join(errs...))
+		if gate := phase.readinessGate(); gate != "" && slices.Contains(owner.Spec.ReadinessGates, gate) {
+			for _, obj := range appliedObjects {
+				if !isWorkloadReady(obj) {
+					// The remaining phases will be applied in a subsequent reconcile.
+					// Pruning is skipped, because the objects of the remaining phases were not visited yet.
+					log.Info("waiting for workload to become ready before applying the next phase", "phase", phase, "objectName", obj.GetName())
+					return userOwnedObjects, false, nil
+				}
+			}
+		}
 	}
 
 	// Prune owned objects in the cluster which are not managed anymore
@@ -92,16 +302,34 @@ func reconcileManagedObjects(
 			"objectKind", obj.GetObjectKind(),
 		)
 
+		if mode := reconcileModeOf(obj); mode == v1alpha1.ReconcileModeSkip || mode == v1alpha1.ReconcileModeCreateOnly {
+			l.V(1).Info("skipping pruning of resource opted-out of reconciliation", "mode", mode)
+			userOwnedObjects = append(userOwnedObjects, v1alpha1.UserOwnedObject{
+				Kind: objectKind(obj, scheme),
+				Name: obj.GetName(),
+				Mode: mode,
+			})
+			continue
+		}
+
 		l.Info("pruning unmanaged resource")
 		err := k8sclient.Delete(ctx, obj)
 		if err != nil {
 			l.Error(err, "failed to delete resource")
 			pruneErrs = append(pruneErrs, err)
+		} else {
+			recorder.Eventf(owner, corev1.EventTypeNormal, "Pruned", "Deleted %s %s, which is not rendered by the helm chart anymore", objectKind(obj, scheme), obj.GetName())
 		}
 	}
 	if len(pruneErrs) > 0 {
-		return fmt.Errorf("failed to prune objects for %s: %w", owner.GetName(), errors.Join(pruneErrs...))
+		return userOwnedObjects, false, fmt.Errorf("failed to prune objects for %s: %w", owner.GetName(), errors.Join(pruneErrs...))
 	}
 
-	return nil
+	return userOwnedObjects, true, nil
+}
+
+// recordRecreation emits an event for an object which is re-created, because an immutable field changed.
+func recordRecreation(recorder record.EventRecorder, owner *v1alpha1.TempoMicroservices, scheme *runtime.Scheme, obj client.Object, field string) {
+	recorder.Eventf(owner, corev1.EventTypeNormal, "Recreating",
+		"Re-creating %s %s, because the immutable field %s changed", objectKind(obj, scheme), obj.GetName(), field)
 }
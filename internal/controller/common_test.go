@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+func TestReconcileManagedObjectsOptOut(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	owner := &v1alpha1.TempoMicroservices{ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "tempo", UID: "owner-uid"}}
+	configMap := func(name string, data string, mode v1alpha1.ReconcileMode) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "tempo", UID: types.UID(name + "-uid")},
+			Data:       map[string]string{"tempo.yaml": data},
+		}
+		if mode != "" {
+			cm.Annotations = map[string]string{v1alpha1.ReconcileAnnotation: string(mode)}
+		}
+		g.Expect(ctrl.SetControllerReference(owner, cm, scheme)).To(Succeed())
+		return cm
+	}
+
+	liveManaged := configMap("managed", "a", "")
+	liveSkipped := configMap("skipped", "a", v1alpha1.ReconcileModeSkip)
+	liveCreateOnly := configMap("create-only", "a", v1alpha1.ReconcileModeCreateOnly)
+	liveSkippedPruned := configMap("skipped-pruned", "a", v1alpha1.ReconcileModeSkip)
+	liveCreateOnlyPruned := configMap("create-only-pruned", "a", v1alpha1.ReconcileModeCreateOnly)
+	k8sclient := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(liveManaged, liveSkipped, liveCreateOnly, liveSkippedPruned, liveCreateOnlyPruned).
+		Build()
+
+	manifests := []client.Object{
+		configMap("managed", "b", ""),
+		configMap("skipped", "b", ""),
+		configMap("create-only", "b", ""),
+		configMap("created", "b", ""),
+	}
+	ownedObjects := map[types.UID]client.Object{}
+	for _, obj := range []client.Object{liveManaged, liveSkipped, liveCreateOnly, liveSkippedPruned, liveCreateOnlyPruned} {
+		ownedObjects[obj.GetUID()] = obj
+	}
+
+	userOwned, applied, err := reconcileManagedObjects(ctx, k8sclient, owner, scheme, record.NewFakeRecorder(10), manifests, ownedObjects)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(applied).To(BeTrue())
+	g.Expect(userOwned).To(ConsistOf(
+		v1alpha1.UserOwnedObject{Kind: "ConfigMap", Name: "skipped", Mode: v1alpha1.ReconcileModeSkip},
+		v1alpha1.UserOwnedObject{Kind: "ConfigMap", Name: "create-only", Mode: v1alpha1.ReconcileModeCreateOnly},
+		v1alpha1.UserOwnedObject{Kind: "ConfigMap", Name: "skipped-pruned", Mode: v1alpha1.ReconcileModeSkip},
+		v1alpha1.UserOwnedObject{Kind: "ConfigMap", Name: "create-only-pruned", Mode: v1alpha1.ReconcileModeCreateOnly},
+	))
+
+	data := func(name string) string {
+		cm := &corev1.ConfigMap{}
+		g.Expect(k8sclient.Get(ctx, client.ObjectKey{Namespace: "tempo", Name: name}, cm)).To(Succeed())
+		return cm.Data["tempo.yaml"]
+	}
+	// objects opted-out of reconciliation are neither overwritten nor pruned, missing objects are created
+	g.Expect(data("managed")).To(Equal("b"))
+	g.Expect(data("skipped")).To(Equal("a"))
+	g.Expect(data("create-only")).To(Equal("a"))
+	g.Expect(data("skipped-pruned")).To(Equal("a"))
+	g.Expect(data("create-only-pruned")).To(Equal("a"))
+	g.Expect(data("created")).To(Equal("b"))
+}
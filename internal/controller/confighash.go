@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// configHashAnnotation is the pod template annotation containing the hash of all ConfigMaps and Secrets used by a workload.
+// A change of any ConfigMap or Secret changes the pod template, and therefore triggers a rollout of the workload.
+const configHashAnnotation = "tempo.grafana.com/config-hash"
+
+// podConfigReferences returns the names of all ConfigMaps and Secrets referenced by a pod spec.
+func podConfigReferences(spec corev1.PodSpec) (sets.Set[string], sets.Set[string]) {
+	configMaps := sets.New[string]()
+	secrets := sets.New[string]()
+
+	for _, volume := range spec.Volumes {
+		if volume.ConfigMap != nil {
+			configMaps.Insert(volume.ConfigMap.Name)
+		}
+		if volume.Secret != nil {
+			secrets.Insert(volume.Secret.SecretName)
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					configMaps.Insert(source.ConfigMap.Name)
+				}
+				if source.Secret != nil {
+					secrets.Insert(source.Secret.Name)
+				}
+			}
+		}
+	}
+
+	containers := append([]corev1.Container{}, spec.InitContainers...)
+	containers = append(containers, spec.Containers...)
+	for _, container := range containers {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				configMaps.Insert(envFrom.ConfigMapRef.Name)
+			}
+			if envFrom.SecretRef != nil {
+				secrets.Insert(envFrom.SecretRef.Name)
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if env.ValueFrom.ConfigMapKeyRef != nil {
+				configMaps.Insert(env.ValueFrom.ConfigMapKeyRef.Name)
+			}
+			if env.ValueFrom.SecretKeyRef != nil {
+				secrets.Insert(env.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+	}
+
+	return configMaps, secrets
+}
+
+// configHash computes the hash of the data of all referenced ConfigMaps and Secrets.
+// References to objects which are not part of the manifests are ignored.
+func configHash(configMapRefs, secretRefs sets.Set[string], configMaps map[string]*corev1.ConfigMap, secrets map[string]*corev1.Secret) (string, error) {
+	h := sha256.New()
+	for _, name := range sets.List(configMapRefs) {
+		cm, ok := configMaps[name]
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal([]interface{}{cm.Data, cm.BinaryData})
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "configmap/%s:%s\n", name, data)
+	}
+	for _, name := range sets.List(secretRefs) {
+		secret, ok := secrets[name]
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal([]interface{}{secret.Data, secret.StringData})
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "secret/%s:%s\n", name, data)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// annotateConfigHashes stamps the hash of all ConfigMaps and Secrets mounted by each Deployment and StatefulSet of the manifests
+// as annotation on the pod template. Workloads are only restarted if a ConfigMap or Secret used by them is changed.
+// The hash is computed from the ConfigMaps and Secrets in configObjects, usually the manifests themselves.
+func annotateConfigHashes(manifests []client.Object, configObjects []client.Object) error {
+	configMaps := map[string]*corev1.ConfigMap{}
+	secrets := map[string]*corev1.Secret{}
+	for _, obj := range configObjects {
+		switch o := obj.(type) {
+		case *corev1.ConfigMap:
+			configMaps[o.Name] = o
+		case *corev1.Secret:
+			secrets[o.Name] = o
+		}
+	}
+
+	for _, obj := range manifests {
+		var template *corev1.PodTemplateSpec
+		switch o := obj.(type) {
+		case *appsv1.Deployment:
+			template = &o.Spec.Template
+		case *appsv1.StatefulSet:
+			template = &o.Spec.Template
+		default:
+			continue
+		}
+
+		configMapRefs, secretRefs := podConfigReferences(template.Spec)
+		hash, err := configHash(configMapRefs, secretRefs, configMaps, secrets)
+		if err != nil {
+			return fmt.Errorf("cannot compute config hash of %s: %w", obj.GetName(), err)
+		}
+
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[configHashAnnotation] = hash
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestPodConfigReferences(t *testing.T) {
+	tests := []struct {
+		name       string
+		spec       corev1.PodSpec
+		configMaps []string
+		secrets    []string
+	}{
+		{
+			name:       "no references",
+			spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "tempo"}}},
+			configMaps: []string{},
+			secrets:    []string{},
+		},
+		{
+			name: "volumes",
+			spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{
+					{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "tempo-config"}}}},
+					{Name: "tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "tempo-certs"}}},
+					{Name: "data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+				},
+			},
+			configMaps: []string{"tempo-config"},
+			secrets:    []string{"tempo-certs"},
+		},
+		{
+			name: "projected volumes",
+			spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{{
+					Name: "projected",
+					VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+						{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "tempo-runtime"}}},
+						{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "tempo-ca"}}},
+					}}},
+				}},
+			},
+			configMaps: []string{"tempo-runtime"},
+			secrets:    []string{"tempo-ca"},
+		},
+		{
+			name: "env and envFrom of containers and init containers",
+			spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{
+					Name:    "init",
+					EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "init-env"}}}},
+				}},
+				Containers: []corev1.Container{{
+					Name:    "tempo",
+					EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "storage-env"}}}},
+					Env: []corev1.EnvVar{
+						{Name: "PLAIN", Value: "value"},
+						{Name: "FROM_CM", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}, Key: "key"}}},
+						{Name: "FROM_SECRET", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "storage"}, Key: "key"}}},
+					},
+				}},
+			},
+			configMaps: []string{"init-env", "settings"},
+			secrets:    []string{"storage", "storage-env"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			configMaps, secrets := podConfigReferences(test.spec)
+			g.Expect(sets.List(configMaps)).To(Equal(test.configMaps))
+			g.Expect(sets.List(secrets)).To(Equal(test.secrets))
+		})
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	configMaps := map[string]*corev1.ConfigMap{
+		"config": {Data: map[string]string{"tempo.yaml": "a"}},
+	}
+	secrets := map[string]*corev1.Secret{
+		"certs": {Data: map[string][]byte{"tls.crt": []byte("a")}},
+	}
+	hash := func(configMapRefs, secretRefs []string, configMaps map[string]*corev1.ConfigMap, secrets map[string]*corev1.Secret) string {
+		h, err := configHash(sets.New(configMapRefs...), sets.New(secretRefs...), configMaps, secrets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	base := hash([]string{"config"}, []string{"certs"}, configMaps, secrets)
+
+	tests := []struct {
+		name       string
+		configMaps map[string]*corev1.ConfigMap
+		secrets    map[string]*corev1.Secret
+		changed    bool
+	}{
+		{
+			name:       "unchanged",
+			configMaps: configMaps,
+			secrets:    secrets,
+			changed:    false,
+		},
+		{
+			name:       "unreferenced object changed",
+			configMaps: map[string]*corev1.ConfigMap{"config": configMaps["config"], "other": {Data: map[string]string{"x": "y"}}},
+			secrets:    secrets,
+			changed:    false,
+		},
+		{
+			name:       "referenced ConfigMap changed",
+			configMaps: map[string]*corev1.ConfigMap{"config": {Data: map[string]string{"tempo.yaml": "b"}}},
+			secrets:    secrets,
+			changed:    true,
+		},
+		{
+			name:       "referenced Secret changed",
+			configMaps: configMaps,
+			secrets:    map[string]*corev1.Secret{"certs": {Data: map[string][]byte{"tls.crt": []byte("b")}}},
+			changed:    true,
+		},
+		{
+			name:       "referenced Secret is not rendered",
+			configMaps: configMaps,
+			secrets:    map[string]*corev1.Secret{},
+			changed:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			h := hash([]string{"config"}, []string{"certs"}, test.configMaps, test.secrets)
+			if test.changed {
+				g.Expect(h).NotTo(Equal(base))
+			} else {
+				g.Expect(h).To(Equal(base))
+			}
+		})
+	}
+}
+
+func TestAnnotateConfigHashes(t *testing.T) {
+	g := NewWithT(t)
+
+	workload := func(configMap string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: configMap},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: configMap}}}}},
+			}}},
+		}
+	}
+	render := func(a, b string) []client.Object {
+		return []client.Object{
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Data: map[string]string{"data": a}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "b"}, Data: map[string]string{"data": b}},
+			workload("a"),
+			workload("b"),
+		}
+	}
+	hashes := func(manifests []client.Object) []string {
+		g.Expect(annotateConfigHashes(manifests, manifests)).To(Succeed())
+		return []string{
+			manifests[2].(*appsv1.Deployment).Spec.Template.Annotations[configHashAnnotation],
+			manifests[3].(*appsv1.Deployment).Spec.Template.Annotations[configHashAnnotation],
+		}
+	}
+
+	before := hashes(render("1", "1"))
+	after := hashes(render("2", "1"))
+	g.Expect(after[0]).NotTo(Equal(before[0]), "the workload using the changed ConfigMap must roll")
+	g.Expect(after[1]).To(Equal(before[1]), "the workload using the unchanged ConfigMap must not roll")
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+// appliedHashAnnotation contains the hash of the desired state of an object, as last applied by the operator.
+// If a live object differs from its desired state while the hash is unchanged, the object was modified outside the operator.
+const appliedHashAnnotation = "tempo.grafana.com/applied-hash"
+
+var driftCorrectionsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tempo_operator_drift_corrections_total",
+		Help: "Number of changes to managed objects made outside the operator, which were reverted by the operator.",
+	},
+	[]string{"namespace", "instance", "kind", "object"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(driftCorrectionsTotal)
+}
+
+// setAppliedHash computes the hash of the desired state of an object and stores it in the applied hash annotation.
+// Metadata populated by the API server and the status are not part of the desired state, and are not hashed.
+func setAppliedHash(obj client.Object) (string, error) {
+	annotations := obj.GetAnnotations()
+	delete(annotations, appliedHashAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+
+	fields, err := comparableFields(obj)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[appliedHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+	return hash, nil
+}
+
+// detectDrift returns the fields of an object which were modified outside the operator and reverted by the last update.
+// existing is the live object before the update, updated is the object returned by the API server after the update,
+// and desiredHash is the applied hash of the desired state.
+// If the desired state changed since the last update, the changes are not considered a drift.
+func detectDrift(existing, updated client.Object, desiredHash string) ([]string, error) {
+	if existing.GetAnnotations()[appliedHashAnnotation] != desiredHash {
+		return nil, nil
+	}
+	return diffObjects(existing, updated)
+}
+
+// recordDrift emits an event and increments the drift corrections metric for an object which was reverted to its desired state.
+func recordDrift(recorder record.EventRecorder, owner *v1alpha1.TempoMicroservices, scheme *runtime.Scheme, obj client.Object, fields []string) {
+	kind := objectKind(obj, scheme)
+	driftCorrectionsTotal.WithLabelValues(owner.Namespace, owner.Name, kind, obj.GetName()).Inc()
+	recorder.Eventf(owner, corev1.EventTypeWarning, "DriftCorrected",
+		"Reverted changes to %s %s made outside the operator: %s", kind, obj.GetName(), strings.Join(fields, ", "))
+}
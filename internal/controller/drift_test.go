@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+func TestSetAppliedHash(t *testing.T) {
+	desired := func() *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "tempo", Namespace: "tempo", Labels: map[string]string{"app": "tempo"}},
+			Data:       map[string]string{"tempo.yaml": "a"},
+		}
+	}
+	hash := func(obj *corev1.ConfigMap) string {
+		h, err := setAppliedHash(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := NewWithT(t)
+		g.Expect(obj.Annotations).To(HaveKeyWithValue(appliedHashAnnotation, h))
+		return h
+	}
+	base := hash(desired())
+
+	tests := []struct {
+		name    string
+		obj     func() *corev1.ConfigMap
+		changed bool
+	}{
+		{
+			name:    "unchanged",
+			obj:     desired,
+			changed: false,
+		},
+		{
+			name: "previous applied hash",
+			obj: func() *corev1.ConfigMap {
+				obj := desired()
+				obj.Annotations = map[string]string{appliedHashAnnotation: "previous"}
+				return obj
+			},
+			changed: false,
+		},
+		{
+			name: "metadata populated by the API server",
+			obj: func() *corev1.ConfigMap {
+				obj := desired()
+				obj.ResourceVersion = "42"
+				obj.UID = "uid"
+				obj.Generation = 3
+				obj.CreationTimestamp = metav1.NewTime(time.Now())
+				obj.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl", Operation: metav1.ManagedFieldsOperationUpdate}}
+				return obj
+			},
+			changed: false,
+		},
+		{
+			name: "data changed",
+			obj: func() *corev1.ConfigMap {
+				obj := desired()
+				obj.Data["tempo.yaml"] = "b"
+				return obj
+			},
+			changed: true,
+		},
+		{
+			name: "labels changed",
+			obj: func() *corev1.ConfigMap {
+				obj := desired()
+				obj.Labels["app"] = "other"
+				return obj
+			},
+			changed: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			h := hash(test.obj())
+			if test.changed {
+				g.Expect(h).NotTo(Equal(base))
+			} else {
+				g.Expect(h).To(Equal(base))
+			}
+		})
+	}
+}
+
+func TestCreateCertsAppliedHash(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	tempo := v1alpha1.TempoMicroservices{ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "tempo"}}
+	k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+	hashes := func() ([]string, []client.Object) {
+		secrets, _, err := createCerts(ctx, k8sclient, tempo)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		hashes := []string{}
+		for _, secret := range secrets {
+			h, err := setAppliedHash(secret)
+			g.Expect(err).NotTo(HaveOccurred())
+			hashes = append(hashes, h)
+		}
+		return hashes, secrets
+	}
+
+	issued, secrets := hashes()
+	// the live Secrets contain metadata populated by the API server
+	for _, secret := range secrets {
+		g.Expect(k8sclient.Create(ctx, secret)).To(Succeed())
+	}
+	reused, _ := hashes()
+	g.Expect(reused).To(Equal(issued), "the certificates of the live Secrets must hash the same as the issued certificates")
+}
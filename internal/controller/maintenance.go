@@ -0,0 +1,318 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/status"
+)
+
+// chartLabel contains the name and version of the helm chart which rendered an object.
+const chartLabel = "helm.sh/chart"
+
+// certificateRotationMargin is the time reserved at the start of a maintenance window to roll out a deferred CA rotation.
+// A CA rotation is only deferred if all affected certificates are valid until this margin after the start of the next window.
+const certificateRotationMargin = time.Hour
+
+// chartVersionLabels are the labels of an object which change with every upgrade of the helm chart.
+var chartVersionLabels = []string{chartLabel, "app.kubernetes.io/version"}
+
+// maintenanceSchedule is a parsed maintenance window.
+type maintenanceSchedule struct {
+	schedule cron.Schedule
+	duration time.Duration
+}
+
+// parseMaintenanceWindows parses the cron schedules of the maintenance windows.
+// The schedules are evaluated in UTC.
+func parseMaintenanceWindows(windows []v1alpha1.MaintenanceWindow) ([]maintenanceSchedule, error) {
+	schedules := []maintenanceSchedule{}
+	for _, window := range windows {
+		schedule, err := cron.ParseStandard(window.Schedule)
+		if err != nil {
+			return nil, &status.ConfigurationError{
+				Reason:  v1alpha1.ReasonInvalidMaintenanceWindow,
+				Message: fmt.Sprintf("invalid schedule %q of maintenance window: %v", window.Schedule, err),
+			}
+		}
+		schedules = append(schedules, maintenanceSchedule{schedule: schedule, duration: window.Duration.Duration})
+	}
+	return schedules, nil
+}
+
+// inMaintenanceWindow checks if now is inside any of the maintenance windows.
+func inMaintenanceWindow(schedules []maintenanceSchedule, now time.Time) bool {
+	now = now.UTC()
+	for _, s := range schedules {
+		// the window is active if it started within the last duration
+		if start := s.schedule.Next(now.Add(-s.duration)); !start.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextMaintenanceWindow returns the start of the next maintenance window after now.
+func nextMaintenanceWindow(schedules []maintenanceSchedule, now time.Time) time.Time {
+	now = now.UTC()
+	var next time.Time
+	for _, s := range schedules {
+		start := s.schedule.Next(now)
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return next
+}
+
+// deferDisruptiveChanges removes the disruptive changes from the rendered manifests.
+// Objects which would be re-created, or which are changed by an upgrade of the helm chart, as well as a rotated CA certificate
+// and the certificates signed by it, are removed from the manifests and their live objects are returned, to exclude them from pruning.
+// A change of the pod template of an ingester StatefulSet is reverted to the live pod template, all other fields are still applied.
+// A CA rotation is not deferred if the live CA certificate, or a live certificate signed by it, expires before the deadline.
+// The config hashes of the remaining workloads are computed from the live data of deferred ConfigMaps and Secrets,
+// because the workloads must not be restarted before the deferred changes are applied.
+func deferDisruptiveChanges(
+	ctx context.Context,
+	k8sclient client.Client,
+	owner *v1alpha1.TempoMicroservices,
+	scheme *runtime.Scheme,
+	manifests []client.Object,
+	deadline time.Time,
+) ([]client.Object, map[types.UID]client.Object, []v1alpha1.DeferredChange, error) {
+	log := log.FromContext(ctx)
+	objects := []client.Object{}
+	deferredObjects := map[types.UID]client.Object{}
+	deferredChanges := []v1alpha1.DeferredChange{}
+	reverted := sets.New[client.Object]()
+	var rotatedCA, liveCA *corev1.Secret
+
+	for _, obj := range manifests {
+		live := obj.DeepCopyObject().(client.Object)
+		err := k8sclient.Get(ctx, client.ObjectKeyFromObject(obj), live)
+		if apierrors.IsNotFound(err) {
+			objects = append(objects, obj)
+			continue
+		} else if err != nil {
+			return nil, nil, nil, err
+		}
+
+		change, err := classifyChange(owner, live, obj)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		switch change {
+		case "":
+			objects = append(objects, obj)
+			continue
+		case v1alpha1.DisruptiveChangeIngesterRestart:
+			sts := obj.(*appsv1.StatefulSet)
+			liveSts := live.(*appsv1.StatefulSet)
+			sts.Spec.Template = liveSts.Spec.Template
+			setAnnotation(sts, templateHashAnnotation, liveSts.Annotations[templateHashAnnotation])
+			objects = append(objects, sts)
+			reverted.Insert(sts)
+		case v1alpha1.DisruptiveChangeCARotation:
+			// the rotation is deferred together with the certificates signed by the new CA, see below
+			rotatedCA = obj.(*corev1.Secret)
+			liveCA = live.(*corev1.Secret)
+			objects = append(objects, obj)
+			continue
+		default:
+			deferredObjects[live.GetUID()] = live
+		}
+
+		log.Info("deferring disruptive change until the next maintenance window", "objectName", obj.GetName(), "change", change)
+		deferredChanges = append(deferredChanges, v1alpha1.DeferredChange{
+			Kind:   objectKind(obj, scheme),
+			Name:   obj.GetName(),
+			Change: change,
+		})
+	}
+
+	if rotatedCA != nil {
+		var err error
+		objects, err = deferCARotation(ctx, k8sclient, rotatedCA, liveCA, objects, deferredObjects, deadline)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if _, ok := deferredObjects[liveCA.GetUID()]; ok {
+			log.Info("deferring disruptive change until the next maintenance window", "objectName", rotatedCA.GetName(), "change", v1alpha1.DisruptiveChangeCARotation)
+			deferredChanges = append(deferredChanges, v1alpha1.DeferredChange{
+				Kind:   objectKind(rotatedCA, scheme),
+				Name:   rotatedCA.GetName(),
+				Change: v1alpha1.DisruptiveChangeCARotation,
+			})
+		}
+	}
+
+	if len(deferredObjects) == 0 {
+		return objects, deferredObjects, deferredChanges, nil
+	}
+
+	configObjects := append([]client.Object{}, objects...)
+	for _, live := range deferredObjects {
+		configObjects = append(configObjects, live)
+	}
+	workloads := []client.Object{}
+	for _, obj := range objects {
+		// the pod templates reverted to the live pod templates keep their config hash
+		if !reverted.Has(obj) {
+			workloads = append(workloads, obj)
+		}
+	}
+	if err := annotateConfigHashes(workloads, configObjects); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := annotateTemplateHashes(workloads); err != nil {
+		return nil, nil, nil, err
+	}
+	return objects, deferredObjects, deferredChanges, nil
+}
+
+// deferCARotation removes the rotated CA certificate and the certificates signed by it from the objects, and adds their
+// live Secrets to deferredObjects. The rotation is not deferred if the live CA certificate, or any live certificate
+// signed by it, expires before the deadline, otherwise the components could not communicate anymore until the rotation is applied.
+func deferCARotation(
+	ctx context.Context,
+	k8sclient client.Client,
+	rotatedCA *corev1.Secret,
+	liveCA *corev1.Secret,
+	objects []client.Object,
+	deferredObjects map[types.UID]client.Object,
+	deadline time.Time,
+) ([]client.Object, error) {
+	remaining := []client.Object{}
+	liveSecrets := []*corev1.Secret{liveCA}
+	for _, obj := range objects {
+		if obj == client.Object(rotatedCA) {
+			continue
+		}
+		secret, ok := obj.(*corev1.Secret)
+		if !ok || !bytes.Equal(secret.Data["ca.crt"], rotatedCA.Data[corev1.TLSCertKey]) {
+			remaining = append(remaining, obj)
+			continue
+		}
+
+		live := &corev1.Secret{}
+		err := k8sclient.Get(ctx, client.ObjectKeyFromObject(secret), live)
+		if apierrors.IsNotFound(err) {
+			remaining = append(remaining, obj)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		liveSecrets = append(liveSecrets, live)
+	}
+
+	for _, live := range liveSecrets {
+		if !certificateValidUntil(live.Data[corev1.TLSCertKey], deadline) {
+			log.FromContext(ctx).Info("rotating CA certificate outside of a maintenance window, because a certificate expires before the next maintenance window",
+				"secret", live.Name)
+			return objects, nil
+		}
+	}
+
+	for _, live := range liveSecrets {
+		deferredObjects[live.GetUID()] = live
+	}
+	return remaining, nil
+}
+
+// classifyChange returns the type of the disruptive change required to update the live object to the desired object,
+// or an empty string if the change is not disruptive.
+func classifyChange(owner *v1alpha1.TempoMicroservices, live client.Object, desired client.Object) (v1alpha1.DisruptiveChange, error) {
+	if chart, ok := desired.GetLabels()[chartLabel]; ok && live.GetLabels()[chartLabel] != chart {
+		changed, err := changedByChartUpgrade(live, desired)
+		if err != nil {
+			return "", err
+		}
+		if changed {
+			return v1alpha1.DisruptiveChangeChartUpgrade, nil
+		}
+	}
+
+	if secret, ok := desired.(*corev1.Secret); ok && secret.Name == fmt.Sprintf("%s-tempo-ca-cert", owner.GetName()) {
+		liveSecret := live.(*corev1.Secret)
+		if len(liveSecret.Data[corev1.TLSCertKey]) > 0 && !bytes.Equal(liveSecret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSCertKey]) {
+			return v1alpha1.DisruptiveChangeCARotation, nil
+		}
+		return "", nil
+	}
+
+	// the mutate function is applied on copies of the objects, and returns an ImmutableErr if the object must be re-created
+	err := MutateFuncFor(live.DeepCopyObject().(client.Object), desired.DeepCopyObject().(client.Object))()
+	var immutableErr *ImmutableErr
+	if err != nil && !errors.As(err, &immutableErr) {
+		return "", err
+	}
+
+	switch desired := desired.(type) {
+	case *appsv1.StatefulSet:
+		liveSts := live.(*appsv1.StatefulSet)
+		if immutableErr != nil && !volumeClaimTemplatesExpanded(liveSts, desired) {
+			return v1alpha1.DisruptiveChangeRecreation, nil
+		}
+		// the template hash annotation is missing on StatefulSets created by a previous version of the operator,
+		// in this case the change of the pod template cannot be detected
+		if hash, ok := liveSts.Annotations[templateHashAnnotation]; ok && componentOf(desired) == ingesterComponent &&
+			hash != desired.Annotations[templateHashAnnotation] {
+			return v1alpha1.DisruptiveChangeIngesterRestart, nil
+		}
+	case *appsv1.Deployment:
+		// a Deployment with a changed selector is re-created without downtime by the Recreate selector change strategy
+		if immutableErr != nil && owner.Spec.SelectorChangeStrategy != v1alpha1.SelectorChangeStrategyRecreate {
+			return v1alpha1.DisruptiveChangeRecreation, nil
+		}
+	default:
+		if immutableErr != nil {
+			return v1alpha1.DisruptiveChangeRecreation, nil
+		}
+	}
+	return "", nil
+}
+
+// changedByChartUpgrade checks if an upgrade of the helm chart changes the live object beyond the labels containing the chart version.
+// The labels of the pod template are not reverted, because a changed pod template restarts the pods.
+func changedByChartUpgrade(live client.Object, desired client.Object) (bool, error) {
+	desired = desired.DeepCopyObject().(client.Object)
+	labels := desired.GetLabels()
+	for _, label := range chartVersionLabels {
+		if value, ok := live.GetLabels()[label]; ok {
+			labels[label] = value
+		} else {
+			delete(labels, label)
+		}
+	}
+	desired.SetLabels(labels)
+	// the applied hash annotation is set after the changes are classified
+	if hash, ok := live.GetAnnotations()[appliedHashAnnotation]; ok {
+		setAnnotation(desired, appliedHashAnnotation, hash)
+	}
+
+	updated := live.DeepCopyObject().(client.Object)
+	err := MutateFuncFor(updated, desired)()
+	var immutableErr *ImmutableErr
+	if errors.As(err, &immutableErr) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return !apiequality.Semantic.DeepEqual(live, updated), nil
+}
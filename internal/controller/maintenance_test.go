@@ -0,0 +1,403 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	g := NewWithT(t)
+	schedules, err := parseMaintenanceWindows([]v1alpha1.MaintenanceWindow{
+		{Schedule: "0 2 * * 6", Duration: metav1.Duration{Duration: 2 * time.Hour}},
+		{Schedule: "0 22 * * 3", Duration: metav1.Duration{Duration: time.Hour}},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// 2024-01-06 is a Saturday
+	saturday := time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC)
+	wednesday := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		inside bool
+		next   time.Time
+	}{
+		{
+			name:   "before the window",
+			now:    saturday.Add(time.Hour),
+			inside: false,
+			next:   saturday.Add(2 * time.Hour),
+		},
+		{
+			name:   "start of the window",
+			now:    saturday.Add(2 * time.Hour),
+			inside: true,
+			next:   wednesday.Add(7*24*time.Hour + 22*time.Hour),
+		},
+		{
+			name:   "inside the window",
+			now:    saturday.Add(3 * time.Hour),
+			inside: true,
+			next:   wednesday.Add(7*24*time.Hour + 22*time.Hour),
+		},
+		{
+			name:   "end of the window",
+			now:    saturday.Add(4 * time.Hour),
+			inside: false,
+			next:   wednesday.Add(7*24*time.Hour + 22*time.Hour),
+		},
+		{
+			name:   "inside the second window",
+			now:    wednesday.Add(22*time.Hour + 30*time.Minute),
+			inside: true,
+			next:   saturday.Add(2 * time.Hour),
+		},
+		{
+			name:   "evaluated in UTC",
+			now:    saturday.Add(3 * time.Hour).In(time.FixedZone("UTC+5", 5*60*60)),
+			inside: true,
+			next:   wednesday.Add(7*24*time.Hour + 22*time.Hour),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(inMaintenanceWindow(schedules, test.now)).To(Equal(test.inside))
+			g.Expect(nextMaintenanceWindow(schedules, test.now)).To(Equal(test.next))
+		})
+	}
+}
+
+func TestParseMaintenanceWindowsInvalid(t *testing.T) {
+	g := NewWithT(t)
+	_, err := parseMaintenanceWindows([]v1alpha1.MaintenanceWindow{{Schedule: "every saturday"}})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func newTestCACert(t *testing.T, lifetime time.Duration) []byte {
+	caCfg, err := crypto.MakeSelfSignedCAConfigForDuration("operator", lifetime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certBytes := &bytes.Buffer{}
+	keyBytes := &bytes.Buffer{}
+	if err := caCfg.WriteCertConfig(certBytes, keyBytes); err != nil {
+		t.Fatal(err)
+	}
+	return certBytes.Bytes()
+}
+
+func TestCertificateExpiring(t *testing.T) {
+	g := NewWithT(t)
+	cert := newTestCACert(t, 10*time.Hour)
+
+	g.Expect(certificateExpiring(cert, time.Now())).To(BeFalse())
+	g.Expect(certificateExpiring(cert, time.Now().Add(7*time.Hour))).To(BeFalse())
+	g.Expect(certificateExpiring(cert, time.Now().Add(9*time.Hour))).To(BeTrue())
+	g.Expect(certificateExpiring(cert, time.Now().Add(11*time.Hour))).To(BeTrue())
+	g.Expect(certificateExpiring([]byte("invalid"), time.Now())).To(BeTrue())
+}
+
+func TestClassifyChange(t *testing.T) {
+	owner := &v1alpha1.TempoMicroservices{ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "default"}}
+	chartLabels := func(chart string, version string) map[string]string {
+		return map[string]string{chartLabel: chart, "app.kubernetes.io/version": version}
+	}
+	ingester := func(hash string, storage string) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "tempo-ingester",
+				Namespace:         "default",
+				Labels:            map[string]string{componentLabel: ingesterComponent},
+				Annotations:       map[string]string{templateHashAnnotation: hash},
+				CreationTimestamp: metav1.Now(),
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas:             ptr.To(int32(1)),
+				Selector:             &metav1.LabelSelector{MatchLabels: map[string]string{componentLabel: ingesterComponent}},
+				VolumeClaimTemplates: []corev1.PersistentVolumeClaim{newTestClaimTemplate("data", storage)},
+			},
+		}
+	}
+	caCert := newTestCACert(t, 10*time.Hour)
+	rotatedCACert := newTestCACert(t, 10*time.Hour)
+
+	tests := []struct {
+		name           string
+		live           client.Object
+		desired        client.Object
+		strategy       v1alpha1.SelectorChangeStrategy
+		expectedChange v1alpha1.DisruptiveChange
+	}{
+		{
+			name: "unchanged",
+			live: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "tempo-config", Labels: chartLabels("tempo-distributed-1.9.0", "2.4.1")},
+				Data:       map[string]string{"tempo.yaml": "a"},
+			},
+			desired: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "tempo-config", Labels: chartLabels("tempo-distributed-1.9.0", "2.4.1")},
+				Data:       map[string]string{"tempo.yaml": "a"},
+			},
+			expectedChange: "",
+		},
+		{
+			name: "chart upgrade changing only the chart labels",
+			live: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "tempo-config",
+					Labels:      chartLabels("tempo-distributed-1.9.0", "2.4.1"),
+					Annotations: map[string]string{appliedHashAnnotation: "hash"},
+				},
+				Data: map[string]string{"tempo.yaml": "a"},
+			},
+			desired: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "tempo-config", Labels: chartLabels("tempo-distributed-1.10.0", "2.5.0")},
+				Data:       map[string]string{"tempo.yaml": "a"},
+			},
+			expectedChange: "",
+		},
+		{
+			name: "chart upgrade changing the data",
+			live: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "tempo-config", Labels: chartLabels("tempo-distributed-1.9.0", "2.4.1")},
+				Data:       map[string]string{"tempo.yaml": "a"},
+			},
+			desired: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "tempo-config", Labels: chartLabels("tempo-distributed-1.10.0", "2.5.0")},
+				Data:       map[string]string{"tempo.yaml": "b"},
+			},
+			expectedChange: v1alpha1.DisruptiveChangeChartUpgrade,
+		},
+		{
+			name: "chart upgrade changing the pod template labels",
+			live: func() client.Object {
+				dpl := newTestDeployment("tempo-querier", "uid", true)
+				dpl.Labels = chartLabels("tempo-distributed-1.9.0", "2.4.1")
+				dpl.Spec.Template.Labels = chartLabels("tempo-distributed-1.9.0", "2.4.1")
+				return dpl
+			}(),
+			desired: func() client.Object {
+				dpl := newTestDeployment("tempo-querier", "uid", false)
+				dpl.Labels = chartLabels("tempo-distributed-1.10.0", "2.5.0")
+				dpl.Spec.Template.Labels = chartLabels("tempo-distributed-1.10.0", "2.5.0")
+				return dpl
+			}(),
+			expectedChange: v1alpha1.DisruptiveChangeChartUpgrade,
+		},
+		{
+			name: "rotated CA certificate",
+			live: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "simplest-tempo-ca-cert"},
+				Data:       map[string][]byte{corev1.TLSCertKey: caCert},
+			},
+			desired: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "simplest-tempo-ca-cert"},
+				Data:       map[string][]byte{corev1.TLSCertKey: rotatedCACert},
+			},
+			expectedChange: v1alpha1.DisruptiveChangeCARotation,
+		},
+		{
+			name: "unchanged CA certificate",
+			live: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "simplest-tempo-ca-cert"},
+				Data:       map[string][]byte{corev1.TLSCertKey: caCert},
+			},
+			desired: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "simplest-tempo-ca-cert"},
+				Data:       map[string][]byte{corev1.TLSCertKey: caCert},
+			},
+			expectedChange: "",
+		},
+		{
+			name:           "shrinked volume",
+			live:           ingester("a", "10Gi"),
+			desired:        ingester("a", "5Gi"),
+			expectedChange: v1alpha1.DisruptiveChangeRecreation,
+		},
+		{
+			name:           "expanded volume",
+			live:           ingester("a", "10Gi"),
+			desired:        ingester("a", "20Gi"),
+			expectedChange: "",
+		},
+		{
+			name:           "changed ingester pod template",
+			live:           ingester("a", "10Gi"),
+			desired:        ingester("b", "10Gi"),
+			expectedChange: v1alpha1.DisruptiveChangeIngesterRestart,
+		},
+		{
+			name: "changed Deployment selector",
+			live: func() client.Object {
+				dpl := newTestDeployment("tempo-querier", "uid", true)
+				dpl.CreationTimestamp = metav1.Now()
+				return dpl
+			}(),
+			desired: func() client.Object {
+				dpl := newTestDeployment("tempo-querier", "uid", false)
+				dpl.Spec.Selector.MatchLabels["component"] = "querier"
+				return dpl
+			}(),
+			expectedChange: v1alpha1.DisruptiveChangeRecreation,
+		},
+		{
+			name: "changed Deployment selector with the Recreate strategy",
+			live: func() client.Object {
+				dpl := newTestDeployment("tempo-querier", "uid", true)
+				dpl.CreationTimestamp = metav1.Now()
+				return dpl
+			}(),
+			desired: func() client.Object {
+				dpl := newTestDeployment("tempo-querier", "uid", false)
+				dpl.Spec.Selector.MatchLabels["component"] = "querier"
+				return dpl
+			}(),
+			strategy:       v1alpha1.SelectorChangeStrategyRecreate,
+			expectedChange: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			owner := owner.DeepCopy()
+			owner.Spec.SelectorChangeStrategy = test.strategy
+
+			change, err := classifyChange(owner, test.live, test.desired)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(change).To(Equal(test.expectedChange))
+		})
+	}
+}
+
+func TestDeferCARotation(t *testing.T) {
+	owner := &v1alpha1.TempoMicroservices{ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "default"}}
+	caSecret := func(uid types.UID, cert []byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "simplest-tempo-ca-cert", Namespace: "default", UID: uid},
+			Data:       map[string][]byte{corev1.TLSCertKey: cert},
+		}
+	}
+	certSecret := func(uid types.UID, cert []byte, caCert []byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "simplest-tempo-distributor-certs", Namespace: "default", UID: uid},
+			Data:       map[string][]byte{corev1.TLSCertKey: cert, "ca.crt": caCert},
+		}
+	}
+	distributor := func() *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "tempo-distributor", Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{{Name: "tls", VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{SecretName: "simplest-tempo-distributor-certs"},
+				}}},
+			}}},
+		}
+	}
+
+	liveCACert := newTestCACert(t, 10*time.Hour)
+	liveCert := newTestCACert(t, 10*time.Hour)
+	shortLivedCert := newTestCACert(t, 30*time.Minute)
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		liveCA   []byte
+		liveCert []byte
+		deadline time.Time
+		deferred bool
+	}{
+		{
+			name:     "certificates valid until the next maintenance window",
+			liveCA:   liveCACert,
+			liveCert: liveCert,
+			deadline: now.Add(2 * time.Hour),
+			deferred: true,
+		},
+		{
+			name:     "CA certificate expires before the next maintenance window",
+			liveCA:   liveCACert,
+			liveCert: liveCert,
+			deadline: now.Add(11 * time.Hour),
+			deferred: false,
+		},
+		{
+			name:     "certificate signed by the CA expires before the next maintenance window",
+			liveCA:   liveCACert,
+			liveCert: shortLivedCert,
+			deadline: now.Add(2 * time.Hour),
+			deferred: false,
+		},
+		{
+			name:     "expired CA certificate",
+			liveCA:   []byte("expired"),
+			liveCert: liveCert,
+			deadline: now.Add(2 * time.Hour),
+			deferred: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+			liveCA := caSecret("ca-uid", test.liveCA)
+			liveCertSecret := certSecret("cert-uid", test.liveCert, test.liveCA)
+			k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(liveCA, liveCertSecret).Build()
+
+			// the CA certificate is rotated on every reconcile, if it is not reused
+			hashes := []string{}
+			for i := 0; i < 2; i++ {
+				rotatedCACert := newTestCACert(t, 10*time.Hour)
+				manifests := []client.Object{
+					caSecret("", rotatedCACert),
+					certSecret("", newTestCACert(t, 10*time.Hour), rotatedCACert),
+					distributor(),
+				}
+				g.Expect(annotateConfigHashes(manifests, manifests)).To(Succeed())
+
+				objects, deferredObjects, deferredChanges, err := deferDisruptiveChanges(ctx, k8sclient, owner, scheme.Scheme, manifests, test.deadline)
+				g.Expect(err).NotTo(HaveOccurred())
+
+				if !test.deferred {
+					g.Expect(objects).To(Equal(manifests))
+					g.Expect(deferredObjects).To(BeEmpty())
+					g.Expect(deferredChanges).To(BeEmpty())
+					return
+				}
+
+				g.Expect(objects).To(HaveLen(1))
+				g.Expect(deferredObjects).To(HaveKey(types.UID("ca-uid")))
+				g.Expect(deferredObjects).To(HaveKey(types.UID("cert-uid")))
+				g.Expect(deferredChanges).To(Equal([]v1alpha1.DeferredChange{
+					{Kind: "Secret", Name: "simplest-tempo-ca-cert", Change: v1alpha1.DisruptiveChangeCARotation},
+				}))
+				hashes = append(hashes, objects[0].(*appsv1.Deployment).Spec.Template.Annotations[configHashAnnotation])
+			}
+
+			// the config hash is computed from the live Secret, i.e. the Deployment is not restarted by the deferred rotation
+			live := []client.Object{distributor(), liveCertSecret}
+			g.Expect(annotateConfigHashes(live, live)).To(Succeed())
+			g.Expect(hashes).To(HaveEach(live[0].(*appsv1.Deployment).Spec.Template.Annotations[configHashAnnotation]))
+		})
+	}
+}
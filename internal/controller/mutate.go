@@ -210,6 +210,8 @@ func mutateDeployment(existing, desired *appsv1.Deployment) error {
 	// a new object is going to be created
 	if existing.CreationTimestamp.IsZero() {
 		existing.Spec.Selector = desired.Spec.Selector
+	} else if !apiequality.Semantic.DeepEqual(desired.Spec.Selector, existing.Spec.Selector) {
+		return &ImmutableErr{".spec.selector", existing.Spec.Selector, desired.Spec.Selector}
 	}
 	existing.Spec.Replicas = desired.Spec.Replicas
 	if err := mergeWithOverride(&existing.Spec.Template, desired.Spec.Template); err != nil {
@@ -250,6 +252,7 @@ func mutateStatefulSet(existing, desired *appsv1.StatefulSet) error {
 	existing.Spec.Selector = desired.Spec.Selector
 	existing.Spec.PodManagementPolicy = desired.Spec.PodManagementPolicy
 	existing.Spec.Replicas = desired.Spec.Replicas
+	existing.Spec.UpdateStrategy = desired.Spec.UpdateStrategy
 	for i := range existing.Spec.VolumeClaimTemplates {
 		existing.Spec.VolumeClaimTemplates[i].TypeMeta = desired.Spec.VolumeClaimTemplates[i].TypeMeta
 		existing.Spec.VolumeClaimTemplates[i].ObjectMeta = desired.Spec.VolumeClaimTemplates[i].ObjectMeta
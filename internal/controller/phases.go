@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"sort"
+
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+// applyPhase defines the order in which the managed objects are applied.
+type applyPhase int
+
+const (
+	applyPhaseRBAC applyPhase = iota
+	applyPhaseConfig
+	applyPhaseServices
+	applyPhaseStatefulSets
+	applyPhaseDeployments
+	applyPhaseOther
+)
+
+func (p applyPhase) String() string {
+	switch p {
+	case applyPhaseRBAC:
+		return "RBAC"
+	case applyPhaseConfig:
+		return "Config"
+	case applyPhaseServices:
+		return "Services"
+	case applyPhaseStatefulSets:
+		return "StatefulSets"
+	case applyPhaseDeployments:
+		return "Deployments"
+	default:
+		return "Other"
+	}
+}
+
+// readinessGate returns the readiness gate which can be configured for this phase, if any.
+func (p applyPhase) readinessGate() v1alpha1.ReadinessGate {
+	switch p {
+	case applyPhaseStatefulSets:
+		return v1alpha1.ReadinessGateStatefulSets
+	case applyPhaseDeployments:
+		return v1alpha1.ReadinessGateDeployments
+	default:
+		return ""
+	}
+}
+
+func applyPhaseOf(obj client.Object) applyPhase {
+	switch obj.(type) {
+	case *corev1.ServiceAccount, *rbacv1.Role, *rbacv1.RoleBinding, *rbacv1.ClusterRole, *rbacv1.ClusterRoleBinding:
+		return applyPhaseRBAC
+	case *corev1.ConfigMap, *corev1.Secret:
+		return applyPhaseConfig
+	case *corev1.Service, *networkingv1.Ingress, *routev1.Route:
+		return applyPhaseServices
+	case *appsv1.StatefulSet:
+		return applyPhaseStatefulSets
+	case *appsv1.Deployment:
+		return applyPhaseDeployments
+	default:
+		return applyPhaseOther
+	}
+}
+
+// groupByApplyPhase groups the objects by their apply phase, in the order the phases should be applied.
+// The order of the objects within a phase is preserved.
+func groupByApplyPhase(objects []client.Object) [][]client.Object {
+	sorted := append([]client.Object{}, objects...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return applyPhaseOf(sorted[i]) < applyPhaseOf(sorted[j])
+	})
+
+	groups := [][]client.Object{}
+	for i, obj := range sorted {
+		if i == 0 || applyPhaseOf(obj) != applyPhaseOf(sorted[i-1]) {
+			groups = append(groups, []client.Object{})
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], obj)
+	}
+	return groups
+}
+
+// isWorkloadReady checks if all replicas of a StatefulSet or Deployment are updated and ready.
+// Other objects are always considered ready.
+func isWorkloadReady(obj client.Object) bool {
+	switch o := obj.(type) {
+	case *appsv1.StatefulSet:
+		replicas := ptr.Deref(o.Spec.Replicas, 1)
+		return o.Status.ObservedGeneration >= o.Generation &&
+			o.Status.UpdatedReplicas >= replicas &&
+			o.Status.ReadyReplicas >= replicas
+	case *appsv1.Deployment:
+		replicas := ptr.Deref(o.Spec.Replicas, 1)
+		return o.Status.ObservedGeneration >= o.Generation &&
+			o.Status.UpdatedReplicas >= replicas &&
+			o.Status.ReadyReplicas >= replicas
+	default:
+		return true
+	}
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestGroupByApplyPhase(t *testing.T) {
+	g := NewWithT(t)
+	meta := func(name string) metav1.ObjectMeta { return metav1.ObjectMeta{Name: name} }
+
+	deployment := &appsv1.Deployment{ObjectMeta: meta("distributor")}
+	statefulSet := &appsv1.StatefulSet{ObjectMeta: meta("ingester")}
+	service := &corev1.Service{ObjectMeta: meta("distributor")}
+	route := &routev1.Route{ObjectMeta: meta("query-frontend")}
+	configMap := &corev1.ConfigMap{ObjectMeta: meta("config")}
+	secret := &corev1.Secret{ObjectMeta: meta("certs")}
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: meta("tempo")}
+	clusterRole := &rbacv1.ClusterRole{ObjectMeta: meta("tempo")}
+	pdb := &policyv1.PodDisruptionBudget{ObjectMeta: meta("ingester")}
+
+	groups := groupByApplyPhase([]client.Object{pdb, deployment, statefulSet, service, secret, route, configMap, clusterRole, serviceAccount})
+	g.Expect(groups).To(Equal([][]client.Object{
+		{clusterRole, serviceAccount},
+		{secret, configMap},
+		{service, route},
+		{statefulSet},
+		{deployment},
+		{pdb},
+	}))
+	g.Expect(groupByApplyPhase(nil)).To(BeEmpty())
+}
+
+func TestApplyPhaseOf(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect(applyPhaseOf(&rbacv1.RoleBinding{})).To(Equal(applyPhaseRBAC))
+	g.Expect(applyPhaseOf(&appsv1.StatefulSet{})).To(Equal(applyPhaseStatefulSets))
+	// kinds without a dedicated phase are applied last
+	g.Expect(applyPhaseOf(&policyv1.PodDisruptionBudget{})).To(Equal(applyPhaseOther))
+	g.Expect(applyPhaseOf(&appsv1.DaemonSet{})).To(Equal(applyPhaseOther))
+	g.Expect(applyPhaseOther.readinessGate()).To(BeEmpty())
+}
+
+func TestIsWorkloadReady(t *testing.T) {
+	deployment := func(generation int64, observed int64, updated int32, ready int32) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "distributor", Generation: generation},
+			Spec:       appsv1.DeploymentSpec{Replicas: ptr.To(int32(2))},
+			Status:     appsv1.DeploymentStatus{ObservedGeneration: observed, UpdatedReplicas: updated, ReadyReplicas: ready},
+		}
+	}
+	statefulSet := func(generation int64, observed int64, updated int32, ready int32) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "ingester", Generation: generation},
+			Spec:       appsv1.StatefulSetSpec{Replicas: ptr.To(int32(2))},
+			Status:     appsv1.StatefulSetStatus{ObservedGeneration: observed, UpdatedReplicas: updated, ReadyReplicas: ready},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		obj   client.Object
+		ready bool
+	}{
+		{name: "ready deployment", obj: deployment(2, 2, 2, 2), ready: true},
+		{name: "deployment with unobserved generation", obj: deployment(2, 1, 2, 2), ready: false},
+		{name: "deployment with outdated replicas", obj: deployment(2, 2, 1, 2), ready: false},
+		{name: "deployment with unready replicas", obj: deployment(2, 2, 2, 1), ready: false},
+		{name: "deployment with default replicas", obj: &appsv1.Deployment{Status: appsv1.DeploymentStatus{UpdatedReplicas: 1, ReadyReplicas: 1}}, ready: true},
+		{name: "ready statefulset", obj: statefulSet(2, 2, 2, 2), ready: true},
+		{name: "statefulset with unobserved generation", obj: statefulSet(2, 1, 2, 2), ready: false},
+		{name: "statefulset with outdated replicas", obj: statefulSet(2, 2, 1, 2), ready: false},
+		{name: "statefulset with unready replicas", obj: statefulSet(2, 2, 2, 1), ready: false},
+		{name: "other kind", obj: &corev1.ConfigMap{}, ready: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(isWorkloadReady(test.obj)).To(Equal(test.ready))
+		})
+	}
+}
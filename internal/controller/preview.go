@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+// previewManagedObjects computes the changes required to reconcile all managed objects, without applying them.
+// Creates and updates are validated with a server-side dry-run, the fields of an update are
+// computed by comparing the dry-run result with the live object.
+func previewManagedObjects(
+	ctx context.Context,
+	k8sclient client.Client,
+	owner metav1.Object,
+	scheme *runtime.Scheme,
+	managedObjects []client.Object,
+	ownedObjects map[types.UID]client.Object,
+) ([]v1alpha1.PendingChange, error) {
+	log := log.FromContext(ctx)
+	pruneObjects := ownedObjects
+	changes := []v1alpha1.PendingChange{}
+
+	errs := []error{}
+	for _, obj := range managedObjects {
+		l := log.WithValues(
+			"objectName", obj.GetName(),
+			"objectKind", obj.GetObjectKind().GroupVersionKind(),
+		)
+
+		if isNamespaceScoped(obj) {
+			if err := ctrl.SetControllerReference(owner, obj, scheme); err != nil {
+				l.Error(err, "failed to set controller owner reference to resource")
+				errs = append(errs, err)
+				continue
+			}
+		} else {
+			setOwnerLabels(owner, obj)
+		}
+
+		change, err := previewManagedObject(ctx, k8sclient, scheme, obj)
+		if err != nil {
+			l.Error(err, "failed to preview resource")
+			errs = append(errs, err)
+			continue
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+
+		// This object is still managed by the operator, remove it from the list of objects to prune
+		delete(pruneObjects, obj.GetUID())
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to preview objects for %s: %w", owner.GetName(), errors.Join(errs...))
+	}
+
+	for _, obj := range pruneObjects {
+		if mode := reconcileModeOf(obj); mode == v1alpha1.ReconcileModeSkip || mode == v1alpha1.ReconcileModeCreateOnly {
+			continue
+		}
+		changes = append(changes, v1alpha1.PendingChange{
+			Kind:   objectKind(obj, scheme),
+			Name:   obj.GetName(),
+			Action: v1alpha1.PendingChangeDelete,
+		})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind < changes[j].Kind
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes, nil
+}
+
+// previewManagedObject returns the change required to reconcile a single object,
+// or nil if the live object is already up to date.
+// The UID of the live object is set on obj, if the object exists.
+func previewManagedObject(ctx context.Context, k8sclient client.Client, scheme *runtime.Scheme, obj client.Object) (*v1alpha1.PendingChange, error) {
+	change := &v1alpha1.PendingChange{
+		Kind: objectKind(obj, scheme),
+		Name: obj.GetName(),
+	}
+
+	existing := obj.DeepCopyObject().(client.Object)
+	err := k8sclient.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	if apierrors.IsNotFound(err) {
+		change.Action = v1alpha1.PendingChangeCreate
+		return change, k8sclient.Create(ctx, obj.DeepCopyObject().(client.Object), client.DryRunAll)
+	} else if err != nil {
+		return nil, err
+	}
+	obj.SetUID(existing.GetUID())
+
+	switch reconcileModeOf(existing) {
+	case v1alpha1.ReconcileModeSkip, v1alpha1.ReconcileModeCreateOnly:
+		return nil, nil
+	}
+
+	updated := existing.DeepCopyObject().(client.Object)
+	err = MutateFuncFor(updated, obj)()
+
+	var immutableErr *ImmutableErr
+	if err != nil && errors.As(err, &immutableErr) {
+		change.Action = v1alpha1.PendingChangeRecreate
+		change.Fields = []string{immutableErr.field}
+		return change, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = k8sclient.Update(ctx, updated, client.DryRunAll)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := diffObjects(existing, updated)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	change.Action = v1alpha1.PendingChangeUpdate
+	change.Fields = fields
+	return change, nil
+}
+
+func objectKind(obj client.Object, scheme *runtime.Scheme) string {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return obj.GetObjectKind().GroupVersionKind().Kind
+	}
+	return gvk.Kind
+}
+
+// diffObjects returns the paths of all fields which differ between two objects,
+// ignoring the status and the metadata fields maintained by the API server.
+func diffObjects(existing, desired client.Object) ([]string, error) {
+	existingFields, err := comparableFields(existing)
+	if err != nil {
+		return nil, err
+	}
+	desiredFields, err := comparableFields(desired)
+	if err != nil {
+		return nil, err
+	}
+	return diffFields("", existingFields, desiredFields), nil
+}
+
+func comparableFields(obj client.Object) (map[string]interface{}, error) {
+	fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(fields, "apiVersion")
+	delete(fields, "kind")
+	delete(fields, "status")
+	for _, field := range []string{"managedFields", "resourceVersion", "generation", "creationTimestamp", "uid"} {
+		unstructured.RemoveNestedField(fields, "metadata", field)
+	}
+	unstructured.RemoveNestedField(fields, "metadata", "annotations", appliedHashAnnotation)
+	return fields, nil
+}
+
+// diffFields compares nested maps recursively and returns the paths of all differing fields.
+// Lists are compared as a whole.
+func diffFields(prefix string, existing, desired map[string]interface{}) []string {
+	fields := []string{}
+	keys := sets.KeySet(existing).Union(sets.KeySet(desired))
+	for _, key := range sets.List(keys) {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		existingMap, existingIsMap := existing[key].(map[string]interface{})
+		desiredMap, desiredIsMap := desired[key].(map[string]interface{})
+		if existingIsMap && desiredIsMap {
+			fields = append(fields, diffFields(path, existingMap, desiredMap)...)
+		} else if !apiequality.Semantic.DeepEqual(existing[key], desired[key]) {
+			fields = append(fields, path)
+		}
+	}
+	return fields
+}
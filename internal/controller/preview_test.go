@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+func TestPreviewManagedObjects(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	owner := &v1alpha1.TempoMicroservices{ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "tempo", UID: "owner-uid"}}
+	configMap := func(name string, data string) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "tempo"},
+			Data:       map[string]string{"tempo.yaml": data},
+		}
+		g.Expect(ctrl.SetControllerReference(owner, cm, scheme)).To(Succeed())
+		return cm
+	}
+
+	liveUnchanged := configMap("unchanged", "a")
+	liveChanged := configMap("changed", "a")
+	livePruned := configMap("pruned", "a")
+	livePruned.UID = "pruned-uid"
+	liveSkipped := configMap("skipped", "a")
+	liveSkipped.UID = "skipped-uid"
+	liveSkipped.Annotations = map[string]string{v1alpha1.ReconcileAnnotation: string(v1alpha1.ReconcileModeSkip)}
+	liveUserOwned := configMap("user-owned", "a")
+	liveUserOwned.Annotations = map[string]string{v1alpha1.ReconcileAnnotation: string(v1alpha1.ReconcileModeCreateOnly)}
+	k8sclient := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(liveUnchanged, liveChanged, livePruned, liveSkipped, liveUserOwned).
+		Build()
+
+	initial := &corev1.ConfigMapList{}
+	g.Expect(k8sclient.List(ctx, initial)).To(Succeed())
+
+	manifests := []client.Object{
+		configMap("unchanged", "a"),
+		configMap("changed", "b"),
+		configMap("created", "a"),
+		configMap("user-owned", "b"),
+	}
+	ownedObjects := map[types.UID]client.Object{
+		livePruned.UID:  livePruned,
+		liveSkipped.UID: liveSkipped,
+	}
+
+	changes, err := previewManagedObjects(ctx, k8sclient, owner, scheme, manifests, ownedObjects)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(changes).To(Equal([]v1alpha1.PendingChange{
+		{Kind: "ConfigMap", Name: "changed", Action: v1alpha1.PendingChangeUpdate, Fields: []string{"data.tempo.yaml"}},
+		{Kind: "ConfigMap", Name: "created", Action: v1alpha1.PendingChangeCreate},
+		{Kind: "ConfigMap", Name: "pruned", Action: v1alpha1.PendingChangeDelete},
+	}))
+
+	// the preview does not modify any object
+	live := &corev1.ConfigMapList{}
+	g.Expect(k8sclient.List(ctx, live)).To(Succeed())
+	g.Expect(live.Items).To(Equal(initial.Items))
+	err = k8sclient.Get(ctx, client.ObjectKey{Namespace: "tempo", Name: "created"}, &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
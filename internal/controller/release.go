@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// valuesHash computes the hash of the values used to render the helm chart.
+func valuesHash(vals chartutil.Values) (string, error) {
+	data, err := json.Marshal(vals)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// imageTag returns the tag of a container image, or the digest if the image is referenced by digest.
+func imageTag(image string) string {
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	// a colon before the last slash separates the port of the registry
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return "latest"
+}
+
+// workloadPodSpecs returns the pod specs of the rendered workloads.
+func workloadPodSpecs(manifests []client.Object) []*corev1.PodSpec {
+	podSpecs := []*corev1.PodSpec{}
+	for _, obj := range manifests {
+		switch obj := obj.(type) {
+		case *appsv1.Deployment:
+			podSpecs = append(podSpecs, &obj.Spec.Template.Spec)
+		case *appsv1.StatefulSet:
+			podSpecs = append(podSpecs, &obj.Spec.Template.Spec)
+		}
+	}
+	return podSpecs
+}
+
+// isTempoContainer checks if a container runs a Tempo component.
+// Tempo containers are identified by the -target argument, which selects the component to run.
+func isTempoContainer(container corev1.Container) bool {
+	return slices.ContainsFunc(container.Args, func(arg string) bool { return strings.HasPrefix(arg, "-target=") })
+}
+
+// tempoContainers returns the Tempo containers of the rendered workloads.
+func tempoContainers(manifests []client.Object) []corev1.Container {
+	tempoContainers := []corev1.Container{}
+	for _, podSpec := range workloadPodSpecs(manifests) {
+		for _, container := range podSpec.Containers {
+			if isTempoContainer(container) {
+				tempoContainers = append(tempoContainers, container)
+			}
+		}
+	}
+	return tempoContainers
+}
+
+// tempoVersion returns the image tags of the Tempo containers of the rendered workloads.
+// Multiple tags (e.g. if the image of a component is overridden) are returned as a comma-separated list.
+func tempoVersion(manifests []client.Object) string {
+	tags := sets.New[string]()
+	for _, container := range tempoContainers(manifests) {
+		tags.Insert(imageTag(container.Image))
+	}
+	return strings.Join(sets.List(tags), ",")
+}
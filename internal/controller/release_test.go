@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestImageTag(t *testing.T) {
+	tests := []struct {
+		image string
+		tag   string
+	}{
+		{image: "grafana/tempo:2.4.1", tag: "2.4.1"},
+		{image: "docker.io/grafana/tempo:2.4.1", tag: "2.4.1"},
+		{image: "registry.local:5000/grafana/tempo:2.4.1", tag: "2.4.1"},
+		{image: "registry.local:5000/grafana/tempo", tag: "latest"},
+		{image: "grafana/tempo", tag: "latest"},
+		{image: "grafana/tempo@sha256:abc", tag: "sha256:abc"},
+		{image: "grafana/tempo:2.4.1@sha256:abc", tag: "sha256:abc"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(imageTag(test.image)).To(Equal(test.tag))
+		})
+	}
+}
+
+func TestTempoVersion(t *testing.T) {
+	deployment := func(name string, containers ...corev1.Container) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: containers}},
+			},
+		}
+	}
+	statefulSet := func(name string, containers ...corev1.Container) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: appsv1.StatefulSetSpec{
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: containers}},
+			},
+		}
+	}
+	tempo := func(target string, image string) corev1.Container {
+		return corev1.Container{Name: target, Image: image, Args: []string{"-target=" + target, "-config.file=/conf/tempo.yaml"}}
+	}
+	sidecar := corev1.Container{Name: "sidecar", Image: "proxy:1.0"}
+
+	tests := []struct {
+		name      string
+		manifests []client.Object
+		version   string
+	}{
+		{
+			name:      "no workloads",
+			manifests: []client.Object{&corev1.ConfigMap{}},
+			version:   "",
+		},
+		{
+			name: "same image of all components",
+			manifests: []client.Object{
+				deployment("tempo-distributor", tempo("distributor", "grafana/tempo:2.4.1")),
+				statefulSet("tempo-ingester", tempo("ingester", "grafana/tempo:2.4.1"), sidecar),
+			},
+			version: "2.4.1",
+		},
+		{
+			name: "overridden image of a component",
+			manifests: []client.Object{
+				deployment("tempo-distributor", tempo("distributor", "grafana/tempo:2.4.1")),
+				deployment("tempo-querier", tempo("querier", "grafana/tempo:2.5.0")),
+				statefulSet("tempo-ingester", tempo("ingester", "grafana/tempo:2.4.1")),
+			},
+			version: "2.4.1,2.5.0",
+		},
+		{
+			name: "containers without target are ignored",
+			manifests: []client.Object{
+				deployment("tempo-gateway", sidecar),
+				deployment("tempo-distributor", tempo("distributor", "grafana/tempo:2.4.1")),
+			},
+			version: "2.4.1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(tempoVersion(test.manifests)).To(Equal(test.version))
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/tempoapi"
+)
+
+const (
+	// ringCleanupInterval is the interval for checking the ring for ingesters without a pod.
+	// The ring state is not observable via watches.
+	ringCleanupInterval = 5 * time.Minute
+
+	// maxForgottenRingInstances is the number of removed ring instances listed in the status.
+	maxForgottenRingInstances = 10
+)
+
+func isStaleRingState(state string) bool {
+	return state == tempoapi.InstanceStateLeaving || state == tempoapi.InstanceStateUnhealthy
+}
+
+// ingesterPodNames returns the names of the pods owned by the ingester StatefulSets of the owner.
+// Pods of other workloads in the namespace are not considered, even if their name matches the ID of a ring instance.
+func ingesterPodNames(ctx context.Context, k8sclient client.Client, owner *v1alpha1.TempoMicroservices) (sets.Set[string], error) {
+	statefulSets := &appsv1.StatefulSetList{}
+	err := k8sclient.List(ctx, statefulSets, client.InNamespace(owner.Namespace), client.MatchingLabels{componentLabel: ingesterComponent})
+	if err != nil {
+		return nil, err
+	}
+	statefulSetUIDs := sets.New[types.UID]()
+	for i := range statefulSets.Items {
+		if metav1.IsControlledBy(&statefulSets.Items[i], owner) {
+			statefulSetUIDs.Insert(statefulSets.Items[i].UID)
+		}
+	}
+
+	pods := &corev1.PodList{}
+	err = k8sclient.List(ctx, pods, client.InNamespace(owner.Namespace))
+	if err != nil {
+		return nil, err
+	}
+	podNames := sets.New[string]()
+	for i := range pods.Items {
+		controllerRef := metav1.GetControllerOf(&pods.Items[i])
+		if controllerRef != nil && statefulSetUIDs.Has(controllerRef.UID) {
+			podNames.Insert(pods.Items[i].Name)
+		}
+	}
+	return podNames, nil
+}
+
+// cleanupRing removes ingesters from the ring, which are LEAVING or UNHEALTHY and whose pod does not exist for longer than the grace period.
+// Otherwise, distributors keep returning errors for ingesters which are gone permanently (e.g. after a scale-down or a node loss).
+// The stale and the removed ring instances are stored in newStatus.
+// Returns the duration after which the ring should be checked again.
+func cleanupRing(
+	ctx context.Context,
+	k8sclient client.Client,
+	recorder record.EventRecorder,
+	owner *v1alpha1.TempoMicroservices,
+	api *tempoAPI,
+	newStatus *v1alpha1.TempoMicroservicesStatus,
+) (time.Duration, error) {
+	log := log.FromContext(ctx)
+
+	ring, err := api.ingesterRing(ctx)
+	if err != nil {
+		// the distributor is not available yet, or not available anymore
+		log.Info("cannot read ingester ring, skipping ring cleanup", "error", err.Error())
+		return ringCleanupInterval, nil
+	}
+
+	podNames, err := ingesterPodNames(ctx, k8sclient, owner)
+	if err != nil {
+		return 0, err
+	}
+
+	since := map[string]metav1.Time{}
+	for _, instance := range newStatus.StaleRingInstances {
+		since[instance.ID] = instance.Since
+	}
+
+	now := metav1.Now()
+	gracePeriod := owner.Spec.RingCleanup.GracePeriod.Duration
+	requeueAfter := ringCleanupInterval
+	staleInstances := []v1alpha1.StaleRingInstance{}
+	for _, instance := range ring.Instances {
+		if !isStaleRingState(instance.State) || podNames.Has(instance.ID) {
+			continue
+		}
+
+		staleSince, ok := since[instance.ID]
+		if !ok {
+			staleSince = now
+		}
+
+		remaining := staleSince.Add(gracePeriod).Sub(now.Time)
+		if remaining > 0 {
+			staleInstances = append(staleInstances, v1alpha1.StaleRingInstance{
+				ID:    instance.ID,
+				State: instance.State,
+				Since: staleSince,
+			})
+			requeueAfter = min(requeueAfter, remaining)
+			continue
+		}
+
+		log.Info("removing ingester without a pod from the ring", "instance", instance.ID, "state", instance.State)
+		err = api.distributor.ForgetInstance(ctx, api.distributorURL, instance.ID)
+		if err != nil {
+			return 0, fmt.Errorf("cannot remove ingester %s from the ring: %w", instance.ID, err)
+		}
+
+		recorder.Eventf(owner, corev1.EventTypeNormal, "RingInstanceForgotten",
+			"Removed ingester %s from the ring, it was %s without a pod since %s", instance.ID, instance.State, staleSince.UTC().Format(time.RFC3339))
+		newStatus.ForgottenRingInstances = append(newStatus.ForgottenRingInstances, v1alpha1.ForgottenRingInstance{
+			ID:   instance.ID,
+			Time: now,
+		})
+	}
+
+	if len(newStatus.ForgottenRingInstances) > maxForgottenRingInstances {
+		newStatus.ForgottenRingInstances = newStatus.ForgottenRingInstances[len(newStatus.ForgottenRingInstances)-maxForgottenRingInstances:]
+	}
+	newStatus.StaleRingInstances = staleInstances
+	return requeueAfter, nil
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/tempoapi"
+)
+
+func TestCleanupRing(t *testing.T) {
+	tests := []struct {
+		name         string
+		gracePeriod  time.Duration
+		requests     []string
+		stale        []string
+		forgotten    []string
+		requeueAfter time.Duration
+	}{
+		{
+			name:         "grace period expired",
+			gracePeriod:  0,
+			requests:     []string{"forget tempo-ingester-1"},
+			stale:        []string{},
+			forgotten:    []string{"tempo-ingester-1"},
+			requeueAfter: ringCleanupInterval,
+		},
+		{
+			name:         "within grace period",
+			gracePeriod:  time.Minute,
+			requests:     nil,
+			stale:        []string{"tempo-ingester-1"},
+			forgotten:    []string{},
+			requeueAfter: time.Minute,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+
+			owner := &v1alpha1.TempoMicroservices{
+				ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "default", UID: "owner-uid"},
+				Spec: v1alpha1.TempoMicroservicesSpec{
+					RingCleanup: v1alpha1.RingCleanupSpec{Enabled: true, GracePeriod: metav1.Duration{Duration: test.gracePeriod}},
+				},
+			}
+			sts := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "tempo-ingester",
+					Namespace:       "default",
+					UID:             "sts-uid",
+					Labels:          map[string]string{componentLabel: ingesterComponent},
+					OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(owner, v1alpha1.GroupVersion.WithKind("TempoMicroservices"))},
+				},
+			}
+			// a pod of another workload, whose name matches a ring instance
+			otherPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "tempo-ingester-1", Namespace: "default"}}
+			k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+				sts,
+				newTestIngesterPod(sts, "tempo-ingester-0", "rev-1"),
+				otherPod,
+			).Build()
+
+			fakeAPI := &fakeTempoAPI{ring: map[string]string{
+				"tempo-ingester-0": tempoapi.InstanceStateUnhealthy,
+				"tempo-ingester-1": tempoapi.InstanceStateUnhealthy,
+				"tempo-ingester-2": tempoapi.InstanceStateActive,
+			}}
+			server := httptest.NewServer(fakeAPI)
+			defer server.Close()
+			api := &tempoAPI{distributor: tempoapi.NewClient(nil), distributorURL: server.URL}
+
+			newStatus := &v1alpha1.TempoMicroservicesStatus{}
+			requeueAfter, err := cleanupRing(ctx, k8sclient, record.NewFakeRecorder(10), owner, api, newStatus)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(requeueAfter).To(Equal(test.requeueAfter))
+			g.Expect(fakeAPI.requests).To(Equal(test.requests))
+
+			stale := []string{}
+			for _, instance := range newStatus.StaleRingInstances {
+				stale = append(stale, instance.ID)
+			}
+			g.Expect(stale).To(Equal(test.stale))
+			forgotten := []string{}
+			for _, instance := range newStatus.ForgottenRingInstances {
+				forgotten = append(forgotten, instance.ID)
+			}
+			g.Expect(forgotten).To(Equal(test.forgotten))
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/tempoapi"
+)
+
+const (
+	// shutdownRequestedAnnotation marks an ingester pod which was shut down by the operator,
+	// and will be deleted once the ingester left the ring.
+	shutdownRequestedAnnotation = "tempo.grafana.com/shutdown-requested"
+
+	// rolloutRequeueInterval is the interval for checking the progress of a graceful rollout.
+	// The ring state is not observable via watches.
+	rolloutRequeueInterval = 10 * time.Second
+)
+
+// ingesterStatefulSets returns the ingester StatefulSets of the rendered manifests.
+func ingesterStatefulSets(manifests []client.Object) []*appsv1.StatefulSet {
+	statefulSets := []*appsv1.StatefulSet{}
+	for _, obj := range manifests {
+		if sts, ok := obj.(*appsv1.StatefulSet); ok && componentOf(sts) == ingesterComponent {
+			statefulSets = append(statefulSets, sts)
+		}
+	}
+	return statefulSets
+}
+
+// setOnDeleteUpdateStrategy disables the rolling update of the ingester StatefulSets.
+// The pods are updated by the operator instead, see ingesterRollout.
+func setOnDeleteUpdateStrategy(manifests []client.Object) {
+	for _, sts := range ingesterStatefulSets(manifests) {
+		sts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+			Type: appsv1.OnDeleteStatefulSetStrategyType,
+		}
+	}
+}
+
+// ingesterRollout updates the pods of the ingester StatefulSets one by one.
+// Before a pod is deleted, the ingester is flushed and shut down, and the rollout waits until the ingester left the ring.
+// The next pod is updated once all pods are ready and all ingesters are active in the ring.
+type ingesterRollout struct {
+	client client.Client
+	api    *tempoAPI
+}
+
+// run advances the rollout of all ingester StatefulSets.
+// Returns true if a rollout is in progress.
+func (r *ingesterRollout) run(ctx context.Context, manifests []client.Object) (bool, error) {
+	for _, desired := range ingesterStatefulSets(manifests) {
+		inProgress, err := r.rollout(ctx, desired)
+		if err != nil {
+			return false, fmt.Errorf("rollout of statefulset %s failed: %w", desired.Name, err)
+		}
+		if inProgress {
+			// update a single StatefulSet at a time
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *ingesterRollout) rollout(ctx context.Context, desired *appsv1.StatefulSet) (bool, error) {
+	log := log.FromContext(ctx).WithValues("statefulset", desired.Name)
+
+	sts := &appsv1.StatefulSet{}
+	err := r.client.Get(ctx, client.ObjectKeyFromObject(desired), sts)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	pods, err := listStatefulSetPods(ctx, r.client, sts)
+	if err != nil {
+		return false, err
+	}
+
+	// an ingester was shut down, delete its pod once it left the ring.
+	// Under the OnDelete update strategy, the container of a shut down ingester restarts at the old revision and rejoins the ring,
+	// in this case (or if the ingester did not leave the ring within the shutdown timeout) the pod is deleted without waiting.
+	for _, pod := range pods {
+		if _, ok := pod.Annotations[shutdownRequestedAnnotation]; !ok || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		ring, err := r.api.ingesterRing(ctx)
+		if err != nil {
+			return false, err
+		}
+		if instance := ring.Instance(pod.Name); instance != nil {
+			if !shutdownStalled(pod, instance, time.Now()) {
+				log.Info("waiting for ingester to leave the ring", "pod", pod.Name)
+				return true, nil
+			}
+			log.Info("ingester restarted or did not leave the ring, deleting pod", "pod", pod.Name, "state", instance.State)
+		} else {
+			log.Info("ingester left the ring, deleting pod", "pod", pod.Name)
+		}
+		return true, client.IgnoreNotFound(r.client.Delete(ctx, pod))
+	}
+
+	outdated := []*corev1.Pod{}
+	for _, pod := range pods {
+		if pod.Labels[appsv1.ControllerRevisionHashLabelKey] != sts.Status.UpdateRevision {
+			outdated = append(outdated, pod)
+		}
+	}
+	if len(outdated) == 0 || sts.Status.UpdateRevision == "" {
+		return false, nil
+	}
+
+	// wait until all pods are ready and joined the ring
+	if len(pods) < int(ptr.Deref(sts.Spec.Replicas, 1)) {
+		log.Info("waiting for ingester pods to be created")
+		return true, nil
+	}
+	ring, err := r.api.ingesterRing(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || !isPodReady(pod) {
+			log.Info("waiting for ingester pod to become ready", "pod", pod.Name)
+			return true, nil
+		}
+		instance := ring.Instance(pod.Name)
+		if instance == nil || instance.State != tempoapi.InstanceStateActive {
+			log.Info("waiting for ingester to join the ring", "pod", pod.Name)
+			return true, nil
+		}
+	}
+
+	// update pods in descending ordinal order, like a rolling update
+	sort.Slice(outdated, func(i, j int) bool {
+		return statefulSetPodOrdinal(sts, outdated[i]) > statefulSetPodOrdinal(sts, outdated[j])
+	})
+	pod := outdated[0]
+
+	log.Info("shutting down ingester", "pod", pod.Name)
+	return true, shutdownIngester(ctx, r.client, r.api, pod)
+}
+
+// shutdownIngester flushes and shuts down an ingester, and marks its pod with the shutdown annotation.
+// Once the ingester left the ring, the pod can be deleted.
+func shutdownIngester(ctx context.Context, k8sclient client.Client, api *tempoAPI, pod *corev1.Pod) error {
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[shutdownRequestedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	err := k8sclient.Patch(ctx, pod, patch)
+	if err != nil {
+		return err
+	}
+
+	err = api.ingester.Flush(ctx, api.podURL(pod))
+	if err == nil {
+		err = api.ingester.Shutdown(ctx, api.podURL(pod))
+	}
+	if err != nil {
+		// retry on the next reconcile
+		patch := client.MergeFrom(pod.DeepCopy())
+		delete(pod.Annotations, shutdownRequestedAnnotation)
+		if patchErr := k8sclient.Patch(ctx, pod, patch); patchErr != nil {
+			log.FromContext(ctx).Error(patchErr, "cannot remove shutdown annotation", "pod", pod.Name)
+		}
+		return fmt.Errorf("cannot shut down ingester %s: %w", pod.Name, err)
+	}
+	return nil
+}
+
+// listStatefulSetPods returns the pods controlled by a StatefulSet.
+func listStatefulSetPods(ctx context.Context, k8sclient client.Client, sts *appsv1.StatefulSet) ([]*corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	err := k8sclient.List(ctx, podList, client.InNamespace(sts.Namespace))
+	if err != nil {
+		return nil, err
+	}
+
+	pods := []*corev1.Pod{}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if metav1.IsControlledBy(pod, sts) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
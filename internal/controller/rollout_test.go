@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/tempoapi"
+)
+
+// fakeTempoAPI is a stand-in for the HTTP API of the ingesters and the distributor.
+// The API of an ingester pod is served at /pods/<pod name>.
+type fakeTempoAPI struct {
+	mu       sync.Mutex
+	ring     map[string]string
+	requests []string
+}
+
+func (f *fakeTempoAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/ingester/ring" && r.Method == http.MethodPost {
+		id := r.PostFormValue("forget")
+		f.requests = append(f.requests, "forget "+id)
+		delete(f.ring, id)
+	}
+	if r.URL.Path == "/ingester/ring" {
+		ring := tempoapi.Ring{}
+		for id, state := range f.ring {
+			ring.Instances = append(ring.Instances, tempoapi.RingInstance{ID: id, State: state})
+		}
+		_ = json.NewEncoder(w).Encode(ring)
+		return
+	}
+
+	pod, endpoint, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/pods/"), "/")
+	f.requests = append(f.requests, pod+" "+endpoint)
+	if endpoint == "shutdown" {
+		delete(f.ring, pod)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeTempoAPI) setRingState(id string, state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ring[id] = state
+}
+
+func newTestIngesterPod(sts *appsv1.StatefulSet, name string, revision string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "default",
+			Labels:          map[string]string{appsv1.ControllerRevisionHashLabelKey: revision},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(sts, appsv1.SchemeGroupVersion.WithKind("StatefulSet"))},
+		},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+// newTestIngesterRollout returns a rollout of an ingester StatefulSet with two ready pods of revision rev-1,
+// and the fake API of the ingesters, which are ACTIVE in the ring.
+func newTestIngesterRollout(t *testing.T, updateRevision string) (*ingesterRollout, *appsv1.StatefulSet, *fakeTempoAPI) {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "tempo-ingester",
+			Namespace: "default",
+			UID:       types.UID("sts-uid"),
+			Labels:    map[string]string{componentLabel: ingesterComponent},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: ptr.To(int32(2)),
+		},
+		Status: appsv1.StatefulSetStatus{
+			UpdateRevision: updateRevision,
+		},
+	}
+	k8sclient := fake.NewClientBuilder().WithObjects(
+		sts,
+		newTestIngesterPod(sts, "tempo-ingester-0", "rev-1"),
+		newTestIngesterPod(sts, "tempo-ingester-1", "rev-1"),
+	).Build()
+
+	api := &fakeTempoAPI{ring: map[string]string{
+		"tempo-ingester-0": tempoapi.InstanceStateActive,
+		"tempo-ingester-1": tempoapi.InstanceStateActive,
+	}}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	rollout := &ingesterRollout{
+		client: k8sclient,
+		api: &tempoAPI{
+			ingester:       tempoapi.NewClient(nil),
+			distributor:    tempoapi.NewClient(nil),
+			distributorURL: server.URL,
+			podURL: func(pod *corev1.Pod) string {
+				return server.URL + "/pods/" + pod.Name
+			},
+		},
+	}
+	return rollout, sts, api
+}
+
+func TestIngesterRollout(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	rollout, sts, api := newTestIngesterRollout(t, "rev-2")
+	k8sclient := rollout.client
+	manifests := []client.Object{sts}
+
+	// shuts down the ingester with the highest ordinal
+	inProgress, err := rollout.run(ctx, manifests)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(inProgress).To(BeTrue())
+	g.Expect(api.requests).To(Equal([]string{"tempo-ingester-1 flush", "tempo-ingester-1 shutdown"}))
+
+	pod := &corev1.Pod{}
+	g.Expect(k8sclient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "tempo-ingester-1"}, pod)).To(Succeed())
+	g.Expect(pod.Annotations).To(HaveKey(shutdownRequestedAnnotation))
+
+	// deletes the pod once the ingester left the ring
+	inProgress, err = rollout.run(ctx, manifests)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(inProgress).To(BeTrue())
+	err = k8sclient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "tempo-ingester-1"}, pod)
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+	// waits until the new pod joined the ring
+	g.Expect(k8sclient.Create(ctx, newTestIngesterPod(sts, "tempo-ingester-1", "rev-2"))).To(Succeed())
+	api.setRingState("tempo-ingester-1", tempoapi.InstanceStateJoining)
+	inProgress, err = rollout.run(ctx, manifests)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(inProgress).To(BeTrue())
+	g.Expect(api.requests).To(HaveLen(2))
+
+	// shuts down the next ingester
+	api.setRingState("tempo-ingester-1", tempoapi.InstanceStateActive)
+	inProgress, err = rollout.run(ctx, manifests)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(inProgress).To(BeTrue())
+	g.Expect(api.requests).To(Equal([]string{
+		"tempo-ingester-1 flush", "tempo-ingester-1 shutdown",
+		"tempo-ingester-0 flush", "tempo-ingester-0 shutdown",
+	}))
+}
+
+func TestIngesterRolloutRestartedIngester(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	rollout, sts, api := newTestIngesterRollout(t, "rev-2")
+	k8sclient := rollout.client
+	manifests := []client.Object{sts}
+	key := types.NamespacedName{Namespace: "default", Name: "tempo-ingester-1"}
+
+	inProgress, err := rollout.run(ctx, manifests)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(inProgress).To(BeTrue())
+
+	// the container restarted at the old revision, and the ingester rejoined the ring right after the shutdown
+	api.setRingState("tempo-ingester-1", tempoapi.InstanceStateActive)
+	inProgress, err = rollout.run(ctx, manifests)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(inProgress).To(BeTrue())
+	pod := &corev1.Pod{}
+	g.Expect(k8sclient.Get(ctx, key, pod)).To(Succeed())
+
+	// the pod is deleted once the ingester is still ACTIVE after the rollout requeue interval
+	patch := client.MergeFrom(pod.DeepCopy())
+	pod.Annotations[shutdownRequestedAnnotation] = time.Now().Add(-rolloutRequeueInterval).UTC().Format(time.RFC3339)
+	g.Expect(k8sclient.Patch(ctx, pod, patch)).To(Succeed())
+	inProgress, err = rollout.run(ctx, manifests)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(inProgress).To(BeTrue())
+	err = k8sclient.Get(ctx, key, pod)
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	g.Expect(api.requests).To(Equal([]string{"tempo-ingester-1 flush", "tempo-ingester-1 shutdown"}))
+}
+
+func TestIngesterRolloutUpToDate(t *testing.T) {
+	g := NewWithT(t)
+	rollout, sts, api := newTestIngesterRollout(t, "rev-1")
+
+	inProgress, err := rollout.run(context.Background(), []client.Object{sts})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(inProgress).To(BeFalse())
+	g.Expect(api.requests).To(BeEmpty())
+}
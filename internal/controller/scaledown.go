@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/tempoapi"
+)
+
+// shutdownTimeout is the time after which the shutdown of a departing ingester is requested again, if it did not leave the ring.
+const shutdownTimeout = 5 * time.Minute
+
+// shutdownStalled checks if the shutdown of an ingester must be requested again, because the ingester restarted
+// and is ACTIVE in the ring again, or it did not leave the ring within the shutdown timeout.
+// An ingester can still be ACTIVE right after the shutdown was requested, therefore the state is checked only after the rollout requeue interval.
+func shutdownStalled(pod *corev1.Pod, instance *tempoapi.RingInstance, now time.Time) bool {
+	requestedAt, err := time.Parse(time.RFC3339, pod.Annotations[shutdownRequestedAnnotation])
+	if err != nil {
+		return true
+	}
+
+	elapsed := now.Sub(requestedAt)
+	if instance.State == tempoapi.InstanceStateActive && elapsed >= rolloutRequeueInterval {
+		return true
+	}
+	return elapsed >= shutdownTimeout
+}
+
+// scaleDownIngesters intercepts a decrease of the replicas of the ingester StatefulSets.
+// The departing ingesters are flushed and shut down one at a time, starting with the highest ordinal,
+// and the replicas of the StatefulSet are decreased by one once the ingester left the ring.
+// Until then, the replicas of the rendered StatefulSet are set to the current replicas.
+// If api is nil, i.e. the HTTP API of the ingesters is not available, the current replicas are kept.
+// Returns a message describing the scale-down in progress, or an empty string if no scale-down is in progress.
+func scaleDownIngesters(ctx context.Context, k8sclient client.Client, api *tempoAPI, manifests []client.Object) (string, error) {
+	for _, desired := range ingesterStatefulSets(manifests) {
+		message, err := scaleDownIngester(ctx, k8sclient, api, desired)
+		if err != nil {
+			return "", fmt.Errorf("scale-down of statefulset %s failed: %w", desired.Name, err)
+		}
+		if message != "" {
+			return message, nil
+		}
+	}
+	return "", nil
+}
+
+func scaleDownIngester(ctx context.Context, k8sclient client.Client, api *tempoAPI, desired *appsv1.StatefulSet) (string, error) {
+	log := log.FromContext(ctx).WithValues("statefulset", desired.Name)
+
+	sts := &appsv1.StatefulSet{}
+	err := k8sclient.Get(ctx, client.ObjectKeyFromObject(desired), sts)
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	currentReplicas := ptr.Deref(sts.Spec.Replicas, 1)
+	desiredReplicas := ptr.Deref(desired.Spec.Replicas, 1)
+	if desiredReplicas >= currentReplicas {
+		return "", nil
+	}
+
+	message := fmt.Sprintf("Scaling down statefulset %s from %d to %d replicas", desired.Name, currentReplicas, desiredReplicas)
+	desired.Spec.Replicas = ptr.To(currentReplicas)
+
+	pod := &corev1.Pod{}
+	podName := fmt.Sprintf("%s-%d", sts.Name, currentReplicas-1)
+	err = k8sclient.Get(ctx, types.NamespacedName{Namespace: sts.Namespace, Name: podName}, pod)
+	if apierrors.IsNotFound(err) {
+		desired.Spec.Replicas = ptr.To(currentReplicas - 1)
+		return message, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if api == nil {
+		// the ingester cannot be shut down, the replicas are kept until the HTTP API is available
+		return fmt.Sprintf("%s, waiting for the HTTP API of the ingesters", message), nil
+	}
+
+	if _, ok := pod.Annotations[shutdownRequestedAnnotation]; !ok {
+		log.Info("shutting down ingester before scale-down", "pod", pod.Name)
+		err = shutdownIngester(ctx, k8sclient, api, pod)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s, shutting down ingester %s", message, pod.Name), nil
+	}
+
+	ring, err := api.ingesterRing(ctx)
+	if err != nil {
+		return "", err
+	}
+	if instance := ring.Instance(pod.Name); instance != nil {
+		if shutdownStalled(pod, instance, time.Now()) {
+			log.Info("ingester did not leave the ring, shutting down ingester again", "pod", pod.Name, "state", instance.State)
+			err = shutdownIngester(ctx, k8sclient, api, pod)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s, shutting down ingester %s", message, pod.Name), nil
+		}
+		return fmt.Sprintf("%s, waiting for ingester %s to leave the ring", message, pod.Name), nil
+	}
+
+	log.Info("ingester left the ring, decreasing replicas", "pod", pod.Name, "replicas", currentReplicas-1)
+	desired.Spec.Replicas = ptr.To(currentReplicas - 1)
+	return message, nil
+}
@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/tempoapi"
+)
+
+func TestShutdownStalled(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		requestedAt string
+		state       string
+		stalled     bool
+	}{
+		{
+			name:        "leaving",
+			requestedAt: now.Add(-time.Minute).Format(time.RFC3339),
+			state:       tempoapi.InstanceStateLeaving,
+			stalled:     false,
+		},
+		{
+			name:        "active right after the shutdown request",
+			requestedAt: now.Add(-time.Second).Format(time.RFC3339),
+			state:       tempoapi.InstanceStateActive,
+			stalled:     false,
+		},
+		{
+			name:        "active again after a restart",
+			requestedAt: now.Add(-time.Minute).Format(time.RFC3339),
+			state:       tempoapi.InstanceStateActive,
+			stalled:     true,
+		},
+		{
+			name:        "did not leave the ring within the timeout",
+			requestedAt: now.Add(-shutdownTimeout).Format(time.RFC3339),
+			state:       tempoapi.InstanceStateLeaving,
+			stalled:     true,
+		},
+		{
+			name:        "invalid timestamp",
+			requestedAt: "yes",
+			state:       tempoapi.InstanceStateLeaving,
+			stalled:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{shutdownRequestedAnnotation: test.requestedAt}}}
+			instance := &tempoapi.RingInstance{ID: "tempo-ingester-1", State: test.state}
+			g.Expect(shutdownStalled(pod, instance, now)).To(Equal(test.stalled))
+		})
+	}
+}
+
+func TestScaleDownIngesters(t *testing.T) {
+	requestedAt := func(d time.Duration) string {
+		return time.Now().Add(-d).UTC().Format(time.RFC3339)
+	}
+
+	tests := []struct {
+		name             string
+		desiredReplicas  int32
+		annotation       string
+		ring             map[string]string
+		noPod            bool
+		noAPI            bool
+		renderedReplicas int32
+		requests         []string
+		inProgress       bool
+	}{
+		{
+			name:             "no scale-down",
+			desiredReplicas:  2,
+			ring:             map[string]string{"tempo-ingester-1": tempoapi.InstanceStateActive},
+			renderedReplicas: 2,
+		},
+		{
+			name:             "shuts down the ingester with the highest ordinal",
+			desiredReplicas:  1,
+			ring:             map[string]string{"tempo-ingester-1": tempoapi.InstanceStateActive},
+			renderedReplicas: 2,
+			requests:         []string{"tempo-ingester-1 flush", "tempo-ingester-1 shutdown"},
+			inProgress:       true,
+		},
+		{
+			name:             "waits for the ingester to leave the ring",
+			desiredReplicas:  1,
+			annotation:       requestedAt(time.Minute),
+			ring:             map[string]string{"tempo-ingester-1": tempoapi.InstanceStateLeaving},
+			renderedReplicas: 2,
+			inProgress:       true,
+		},
+		{
+			name:             "shuts down a restarted ingester again",
+			desiredReplicas:  1,
+			annotation:       requestedAt(time.Minute),
+			ring:             map[string]string{"tempo-ingester-1": tempoapi.InstanceStateActive},
+			renderedReplicas: 2,
+			requests:         []string{"tempo-ingester-1 flush", "tempo-ingester-1 shutdown"},
+			inProgress:       true,
+		},
+		{
+			name:             "decreases the replicas once the ingester left the ring",
+			desiredReplicas:  1,
+			annotation:       requestedAt(time.Minute),
+			ring:             map[string]string{},
+			renderedReplicas: 1,
+			inProgress:       true,
+		},
+		{
+			name:             "decreases the replicas if the pod does not exist",
+			desiredReplicas:  1,
+			noPod:            true,
+			ring:             map[string]string{},
+			renderedReplicas: 1,
+			inProgress:       true,
+		},
+		{
+			name:             "keeps the replicas if the API is not available",
+			desiredReplicas:  1,
+			noAPI:            true,
+			renderedReplicas: 2,
+			inProgress:       true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+
+			sts := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "tempo-ingester",
+					Namespace: "default",
+					UID:       "sts-uid",
+					Labels:    map[string]string{componentLabel: ingesterComponent},
+				},
+				Spec: appsv1.StatefulSetSpec{Replicas: ptr.To(int32(2))},
+			}
+			objects := []client.Object{sts, newTestIngesterPod(sts, "tempo-ingester-0", "rev-1")}
+			if !test.noPod {
+				pod := newTestIngesterPod(sts, "tempo-ingester-1", "rev-1")
+				if test.annotation != "" {
+					pod.Annotations = map[string]string{shutdownRequestedAnnotation: test.annotation}
+				}
+				objects = append(objects, pod)
+			}
+			k8sclient := fake.NewClientBuilder().WithObjects(objects...).Build()
+
+			fakeAPI := &fakeTempoAPI{ring: test.ring}
+			server := httptest.NewServer(fakeAPI)
+			defer server.Close()
+			var api *tempoAPI
+			if !test.noAPI {
+				api = &tempoAPI{
+					ingester:       tempoapi.NewClient(nil),
+					distributor:    tempoapi.NewClient(nil),
+					distributorURL: server.URL,
+					podURL: func(pod *corev1.Pod) string {
+						return server.URL + "/pods/" + pod.Name
+					},
+				}
+			}
+
+			desired := sts.DeepCopy()
+			desired.Spec.Replicas = ptr.To(test.desiredReplicas)
+			message, err := scaleDownIngesters(ctx, k8sclient, api, []client.Object{desired})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(message != "").To(Equal(test.inProgress))
+			g.Expect(*desired.Spec.Replicas).To(Equal(test.renderedReplicas))
+			g.Expect(fakeAPI.requests).To(Equal(test.requests))
+		})
+	}
+}
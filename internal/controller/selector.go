@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// temporaryDeploymentSuffix is appended to the name of the temporary Deployment,
+// which serves requests while a Deployment is re-created because of a label selector change.
+const temporaryDeploymentSuffix = "-recreate"
+
+func temporaryDeploymentName(name string) string {
+	return name + temporaryDeploymentSuffix
+}
+
+// recreateDeployment handles a label selector change of a Deployment without downtime.
+// A temporary Deployment with a suffixed name and the new label selector is created,
+// and once it is ready, the existing Deployment is deleted. The Deployment will be created
+// with the new label selector on the next reconcile.
+func recreateDeployment(ctx context.Context, k8sclient client.Client, desired *appsv1.Deployment, pruneObjects map[types.UID]client.Object) error {
+	log := log.FromContext(ctx)
+
+	tmp := desired.DeepCopy()
+	tmp.Name = temporaryDeploymentName(desired.Name)
+
+	wantTmp := tmp.DeepCopy()
+	_, err := ctrl.CreateOrUpdate(ctx, k8sclient, tmp, MutateFuncFor(tmp, wantTmp))
+	if err != nil {
+		return fmt.Errorf("cannot create temporary deployment %s: %w", tmp.Name, err)
+	}
+	delete(pruneObjects, tmp.UID)
+
+	if !isWorkloadReady(tmp) {
+		log.Info("waiting for temporary deployment to become ready", "deployment", tmp.Name)
+		return nil
+	}
+
+	log.Info("temporary deployment is ready, deleting deployment with outdated label selector", "deployment", desired.Name)
+	return client.IgnoreNotFound(k8sclient.Delete(ctx, desired))
+}
+
+// cleanupTemporaryDeployment deletes the temporary Deployment created by recreateDeployment,
+// once the re-created Deployment is ready.
+func cleanupTemporaryDeployment(ctx context.Context, k8sclient client.Client, dpl *appsv1.Deployment, pruneObjects map[types.UID]client.Object) error {
+	tmp := &appsv1.Deployment{}
+	err := k8sclient.Get(ctx, types.NamespacedName{Namespace: dpl.Namespace, Name: temporaryDeploymentName(dpl.Name)}, tmp)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// the temporary Deployment is either deleted here, or still required
+	delete(pruneObjects, tmp.UID)
+	if !isWorkloadReady(dpl) {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("deployment is ready, deleting temporary deployment", "deployment", tmp.Name)
+	return client.IgnoreNotFound(k8sclient.Delete(ctx, tmp))
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestDeployment(name string, uid types.UID, ready bool) *appsv1.Deployment {
+	dpl := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "tempo", UID: uid},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To(int32(1)),
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "tempo"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "tempo"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "tempo", Image: "tempo"}}},
+			},
+		},
+	}
+	if ready {
+		dpl.Status = appsv1.DeploymentStatus{ObservedGeneration: 1, UpdatedReplicas: 1, ReadyReplicas: 1}
+	}
+	return dpl
+}
+
+func TestRecreateDeployment(t *testing.T) {
+	tests := []struct {
+		name        string
+		tmpReady    bool
+		existsAfter bool
+	}{
+		{
+			name:        "temporary deployment is not ready",
+			tmpReady:    false,
+			existsAfter: true,
+		},
+		{
+			name:        "temporary deployment is ready",
+			tmpReady:    true,
+			existsAfter: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+
+			existing := newTestDeployment("tempo-querier", "existing", true)
+			tmp := newTestDeployment(temporaryDeploymentName("tempo-querier"), "tmp", test.tmpReady)
+			k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(existing, tmp).Build()
+			pruneObjects := map[types.UID]client.Object{"existing": existing, "tmp": tmp}
+
+			desired := newTestDeployment("tempo-querier", "", false)
+			desired.Spec.Selector.MatchLabels["component"] = "querier"
+			desired.Spec.Template.Labels["component"] = "querier"
+			g.Expect(recreateDeployment(ctx, k8sclient, desired, pruneObjects)).To(Succeed())
+
+			// the temporary Deployment is created with the new label selector, and must not be pruned
+			live := &appsv1.Deployment{}
+			g.Expect(k8sclient.Get(ctx, client.ObjectKeyFromObject(tmp), live)).To(Succeed())
+			g.Expect(live.Spec.Selector.MatchLabels).To(HaveKeyWithValue("component", "querier"))
+			g.Expect(pruneObjects).NotTo(HaveKey(types.UID("tmp")))
+
+			err := k8sclient.Get(ctx, client.ObjectKeyFromObject(existing), &appsv1.Deployment{})
+			if test.existsAfter {
+				g.Expect(err).NotTo(HaveOccurred())
+			} else {
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			}
+		})
+	}
+}
+
+func TestCleanupTemporaryDeployment(t *testing.T) {
+	tests := []struct {
+		name      string
+		tmpExists bool
+		ready     bool
+		tmpAfter  bool
+	}{
+		{
+			name:      "no temporary deployment",
+			tmpExists: false,
+			ready:     true,
+		},
+		{
+			name:      "re-created deployment is not ready",
+			tmpExists: true,
+			ready:     false,
+			tmpAfter:  true,
+		},
+		{
+			name:      "re-created deployment is ready",
+			tmpExists: true,
+			ready:     true,
+			tmpAfter:  false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+
+			dpl := newTestDeployment("tempo-querier", "dpl", test.ready)
+			tmp := newTestDeployment(temporaryDeploymentName("tempo-querier"), "tmp", true)
+			builder := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(dpl)
+			if test.tmpExists {
+				builder = builder.WithObjects(tmp)
+			}
+			k8sclient := builder.Build()
+			pruneObjects := map[types.UID]client.Object{"tmp": tmp}
+
+			g.Expect(cleanupTemporaryDeployment(ctx, k8sclient, dpl, pruneObjects)).To(Succeed())
+
+			err := k8sclient.Get(ctx, client.ObjectKeyFromObject(tmp), &appsv1.Deployment{})
+			if test.tmpAfter {
+				g.Expect(err).NotTo(HaveOccurred())
+			} else {
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			}
+			if test.tmpExists {
+				g.Expect(pruneObjects).NotTo(HaveKey(types.UID("tmp")), "the temporary Deployment is deleted by the cleanup, not pruned")
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// recreateStatefulSet deletes a StatefulSet with orphan propagation, keeping its pods and PersistentVolumeClaims.
+// The StatefulSet is re-created on the next reconcile and adopts the existing pods, if they match its label selector.
+// Pods which cannot be adopted are replaced one by one, see replaceOrphanedPods.
+func recreateStatefulSet(ctx context.Context, k8sclient client.Client, sts *appsv1.StatefulSet) error {
+	log.FromContext(ctx).Info("deleting statefulset with orphan propagation", "statefulset", sts.Name)
+	return client.IgnoreNotFound(k8sclient.Delete(ctx, sts, client.PropagationPolicy(metav1.DeletePropagationOrphan)))
+}
+
+// statefulSetPodOrdinal returns the ordinal of a pod of a StatefulSet, or -1 if the pod name does not match the StatefulSet.
+// The pods of a StatefulSet are named <statefulset>-<ordinal>.
+func statefulSetPodOrdinal(sts *appsv1.StatefulSet, pod *corev1.Pod) int {
+	suffix, found := strings.CutPrefix(pod.Name, sts.Name+"-")
+	if !found {
+		return -1
+	}
+	ordinal, err := strconv.Atoi(suffix)
+	if err != nil || ordinal < 0 {
+		return -1
+	}
+	return ordinal
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// replaceOrphanedPods deletes the pods left behind by recreateStatefulSet, which were not adopted by the re-created StatefulSet
+// (e.g. because the label selector changed). The StatefulSet cannot create a pod while an orphaned pod with the same name exists.
+// Pods are deleted one at a time in descending ordinal order, like a rolling update,
+// and only if all pods owned by the StatefulSet are ready.
+func replaceOrphanedPods(ctx context.Context, k8sclient client.Client, sts *appsv1.StatefulSet) error {
+	pods := &corev1.PodList{}
+	err := k8sclient.List(ctx, pods, client.InNamespace(sts.Namespace))
+	if err != nil {
+		return err
+	}
+
+	orphaned := []*corev1.Pod{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if statefulSetPodOrdinal(sts, pod) < 0 {
+			continue
+		}
+
+		controllerRef := metav1.GetControllerOf(pod)
+		if controllerRef == nil {
+			if pod.DeletionTimestamp == nil {
+				orphaned = append(orphaned, pod)
+			}
+		} else if controllerRef.UID == sts.UID && !isPodReady(pod) {
+			// wait until all pods of the StatefulSet are ready
+			return nil
+		}
+	}
+	if len(orphaned) == 0 {
+		return nil
+	}
+
+	// the StatefulSet adopts orphaned pods matching its label selector
+	selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(orphaned, func(i, j int) bool {
+		return statefulSetPodOrdinal(sts, orphaned[i]) > statefulSetPodOrdinal(sts, orphaned[j])
+	})
+	for _, pod := range orphaned {
+		if selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+
+		log.FromContext(ctx).Info("replacing pod which was not adopted by the re-created statefulset", "statefulset", sts.Name, "pod", pod.Name)
+		err = client.IgnoreNotFound(k8sclient.Delete(ctx, pod))
+		if err != nil {
+			return fmt.Errorf("cannot delete orphaned pod %s: %w", pod.Name, err)
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestStatefulSetPodOrdinal(t *testing.T) {
+	sts := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "tempo-ingester"}}
+
+	tests := []struct {
+		pod     string
+		ordinal int
+	}{
+		{pod: "tempo-ingester-0", ordinal: 0},
+		{pod: "tempo-ingester-12", ordinal: 12},
+		{pod: "tempo-ingester-zone-a-0", ordinal: -1},
+		{pod: "tempo-ingester", ordinal: -1},
+		{pod: "tempo-ingester--1", ordinal: -1},
+		{pod: "tempo-querier-0", ordinal: -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pod, func(t *testing.T) {
+			g := NewWithT(t)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: test.pod}}
+			g.Expect(statefulSetPodOrdinal(sts, pod)).To(Equal(test.ordinal))
+		})
+	}
+}
+
+func TestReplaceOrphanedPods(t *testing.T) {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "tempo-ingester", Namespace: "tempo", UID: "sts"},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "ingester"}},
+		},
+	}
+	pod := func(name string, labels map[string]string, owned bool, ready bool) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "tempo", Labels: labels},
+			Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionFalse,
+			}}},
+		}
+		if owned {
+			pod.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "apps/v1",
+				Kind:       "StatefulSet",
+				Name:       sts.Name,
+				UID:        sts.UID,
+				Controller: ptr.To(true),
+			}}
+		}
+		if ready {
+			pod.Status.Conditions[0].Status = corev1.ConditionTrue
+		}
+		return pod
+	}
+	oldLabels := map[string]string{"app": "tempo"}
+	newLabels := map[string]string{"app": "ingester"}
+
+	tests := []struct {
+		name    string
+		pods    []client.Object
+		deleted []string
+	}{
+		{
+			name: "no orphaned pods",
+			pods: []client.Object{
+				pod("tempo-ingester-0", newLabels, true, true),
+			},
+			deleted: []string{},
+		},
+		{
+			name: "orphaned pods are replaced in descending ordinal order",
+			pods: []client.Object{
+				pod("tempo-ingester-0", oldLabels, false, true),
+				pod("tempo-ingester-1", oldLabels, false, true),
+				pod("tempo-ingester-2", oldLabels, false, true),
+			},
+			deleted: []string{"tempo-ingester-2"},
+		},
+		{
+			name: "waits until the pods of the statefulset are ready",
+			pods: []client.Object{
+				pod("tempo-ingester-0", oldLabels, false, true),
+				pod("tempo-ingester-1", newLabels, true, false),
+			},
+			deleted: []string{},
+		},
+		{
+			name: "orphaned pods matching the label selector are adopted",
+			pods: []client.Object{
+				pod("tempo-ingester-0", oldLabels, false, true),
+				pod("tempo-ingester-1", newLabels, false, true),
+			},
+			deleted: []string{"tempo-ingester-0"},
+		},
+		{
+			name: "pods of other statefulsets are ignored",
+			pods: []client.Object{
+				pod("tempo-ingester-zone-a-0", oldLabels, false, true),
+				pod("tempo-compactor-0", oldLabels, false, true),
+			},
+			deleted: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+			k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(test.pods...).Build()
+
+			g.Expect(replaceOrphanedPods(ctx, k8sclient, sts)).To(Succeed())
+
+			pods := &corev1.PodList{}
+			g.Expect(k8sclient.List(ctx, pods)).To(Succeed())
+			remaining := map[string]bool{}
+			for _, pod := range pods.Items {
+				remaining[pod.Name] = true
+			}
+			deleted := []string{}
+			for _, pod := range test.pods {
+				if !remaining[pod.GetName()] {
+					deleted = append(deleted, pod.GetName())
+				}
+			}
+			g.Expect(deleted).To(Equal(test.deleted))
+		})
+	}
+}
@@ -0,0 +1,481 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/status"
+)
+
+// requiredStorageSettings lists the settings of each object storage backend which must be configured.
+var requiredStorageSettings = map[string][]string{
+	"s3":    {"bucket", "endpoint"},
+	"gcs":   {"bucket_name"},
+	"azure": {"container_name"},
+}
+
+// credentialSetting is a credential of an object storage backend, which is read from an environment variable if it is not configured.
+type credentialSetting struct {
+	setting string
+	envVar  string
+}
+
+// storageCredentials lists the credentials of each object storage backend.
+// The credentials of the gcs backend are read from a file, or provided by the workload identity, see validateGCSCredentials.
+var storageCredentials = map[string][]credentialSetting{
+	"s3": {
+		{setting: "access_key", envVar: "AWS_ACCESS_KEY_ID"},
+		{setting: "secret_key", envVar: "AWS_SECRET_ACCESS_KEY"},
+	},
+	"azure": {
+		{setting: "storage_account_name", envVar: "AZURE_STORAGE_ACCOUNT"},
+		{setting: "storage_account_key", envVar: "AZURE_STORAGE_KEY"},
+	},
+}
+
+// gcsCredentialsEnvVar contains the path of the credentials file of the gcs backend.
+const gcsCredentialsEnvVar = "GOOGLE_APPLICATION_CREDENTIALS"
+
+// envVarReference matches a reference to an environment variable in the Tempo configuration, e.g. ${AWS_ACCESS_KEY_ID}.
+// References with a default value (${VAR:-default}) are not matched.
+var envVarReference = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// storageValidator validates the object storage configuration.
+// The Secrets and ConfigMaps referenced by the Tempo containers are read from the manifests, or from the cluster.
+type storageValidator struct {
+	client    client.Client
+	namespace string
+	manifests []client.Object
+	problems  []string
+	// missingReferences is set if a referenced Secret or key does not exist, which may be created later
+	missingReferences bool
+}
+
+// validateStorageConfig validates the trace storage configuration of the helm values, and the credentials of the storage backend.
+// The required settings of the backend must be configured, references to environment variables must be defined in all Tempo containers,
+// and the Secrets defining these environment variables and the credentials of the backend must exist and contain the referenced keys.
+// Returns a ConfigurationError listing all problems, which is retried if a referenced Secret or key does not exist.
+func validateStorageConfig(ctx context.Context, k8sclient client.Client, tempo v1alpha1.TempoMicroservices, vals chartutil.Values, manifests []client.Object) error {
+	v := &storageValidator{
+		client:    k8sclient,
+		namespace: tempo.GetNamespace(),
+		manifests: manifests,
+	}
+	err := v.validate(ctx, vals)
+	if err != nil {
+		return err
+	}
+
+	if len(v.problems) > 0 {
+		return &status.ConfigurationError{
+			Reason:  v1alpha1.ReasonInvalidStorageConfig,
+			Message: strings.Join(v.problems, "; "),
+			Retry:   v.missingReferences,
+		}
+	}
+	return nil
+}
+
+func (v *storageValidator) addProblem(format string, a ...interface{}) {
+	problem := fmt.Sprintf(format, a...)
+	if !slices.Contains(v.problems, problem) {
+		v.problems = append(v.problems, problem)
+	}
+}
+
+func (v *storageValidator) addMissingReference(format string, a ...interface{}) {
+	v.addProblem(format, a...)
+	v.missingReferences = true
+}
+
+func (v *storageValidator) validate(ctx context.Context, vals chartutil.Values) error {
+	containers := tempoContainers(v.manifests)
+	backend, _ := vals.PathValue("storage.trace.backend")
+	backendName, _ := backend.(string)
+	switch backendName {
+	case "local":
+		return nil
+	case "s3", "gcs", "azure":
+	default:
+		v.addProblem("unsupported backend %q in storage.trace.backend, supported backends are local, s3, gcs and azure", backendName)
+		return nil
+	}
+
+	settings, err := vals.Table(fmt.Sprintf("storage.trace.%s", backendName))
+	if err != nil {
+		settings = chartutil.Values{}
+	}
+
+	for _, setting := range requiredStorageSettings[backendName] {
+		if !isSettingConfigured(settings, setting) {
+			v.addProblem("storage.trace.%s.%s is not set", backendName, setting)
+		}
+	}
+
+	// all referenced environment variables must be defined
+	names := []string{}
+	for setting := range settings {
+		names = append(names, setting)
+	}
+	sort.Strings(names)
+	for _, setting := range names {
+		value, ok := settings[setting].(string)
+		if !ok {
+			continue
+		}
+		for _, match := range envVarReference.FindAllStringSubmatch(value, -1) {
+			err := v.validateEnvVar(ctx, containers, match[1], fmt.Sprintf("storage.trace.%s.%s", backendName, setting))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if backendName == "gcs" {
+		return v.validateGCSCredentials(ctx)
+	}
+	return v.validateCredentials(ctx, containers, backendName, settings)
+}
+
+// validateCredentials checks if the credentials of the backend are configured, or defined as environment variables.
+func (v *storageValidator) validateCredentials(ctx context.Context, containers []corev1.Container, backend string, settings chartutil.Values) error {
+	configured := []string{}
+	missing := []credentialSetting{}
+	for _, credential := range storageCredentials[backend] {
+		if isSettingConfigured(settings, credential.setting) {
+			configured = append(configured, credential.setting)
+			continue
+		}
+
+		for _, container := range containers {
+			err := v.validateSecretRefs(ctx, container, credential.envVar)
+			if err != nil {
+				return err
+			}
+		}
+		defined, err := v.isEnvVarDefinedInAll(ctx, containers, credential.envVar)
+		if err != nil {
+			return err
+		}
+		if defined {
+			configured = append(configured, credential.envVar)
+		} else {
+			missing = append(missing, credential)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	switch backend {
+	case "s3":
+		// without access keys, the credentials are provided by the IAM role of the pod
+		if len(configured) == 0 {
+			return nil
+		}
+	case "azure":
+		useManagedIdentity, _ := settings["use_managed_identity"].(bool)
+		useFederatedToken, _ := settings["use_federated_token"].(bool)
+		if (useManagedIdentity || useFederatedToken) && len(missing) == 1 && missing[0].setting == "storage_account_key" {
+			return nil
+		}
+	}
+
+	for _, credential := range missing {
+		v.addProblem("storage.trace.%s.%s is not set, and the environment variable %s is not defined", backend, credential.setting, credential.envVar)
+	}
+	return nil
+}
+
+// validateEnvVar checks if an environment variable referenced by a setting is defined in all Tempo containers.
+func (v *storageValidator) validateEnvVar(ctx context.Context, containers []corev1.Container, name string, setting string) error {
+	for _, container := range containers {
+		err := v.validateSecretRefs(ctx, container, name)
+		if err != nil {
+			return err
+		}
+
+		defined, err := v.isEnvVarDefined(ctx, container, name)
+		if err != nil {
+			return err
+		}
+		if !defined {
+			v.addProblem("environment variable %s referenced by %s is not defined in container %s", name, setting, container.Name)
+		}
+	}
+	return nil
+}
+
+func (v *storageValidator) isEnvVarDefinedInAll(ctx context.Context, containers []corev1.Container, name string) (bool, error) {
+	if len(containers) == 0 {
+		return false, nil
+	}
+	for _, container := range containers {
+		defined, err := v.isEnvVarDefined(ctx, container, name)
+		if err != nil || !defined {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// isEnvVarDefined checks if an environment variable is defined in the env or envFrom section of a container.
+func (v *storageValidator) isEnvVarDefined(ctx context.Context, container corev1.Container, name string) (bool, error) {
+	_, defined, err := v.envVarValue(ctx, container, name)
+	return defined, err
+}
+
+// envVarValue returns the value of an environment variable of a container, and if the variable is defined.
+// Values referencing fields of the pod or resources of the container are returned as empty strings.
+func (v *storageValidator) envVarValue(ctx context.Context, container corev1.Container, name string) (string, bool, error) {
+	for _, env := range container.Env {
+		if env.Name != name {
+			continue
+		}
+
+		switch {
+		case env.ValueFrom == nil:
+			return env.Value, true, nil
+		case env.ValueFrom.SecretKeyRef != nil:
+			data, err := v.secretData(ctx, env.ValueFrom.SecretKeyRef.Name)
+			return data[env.ValueFrom.SecretKeyRef.Key], true, err
+		case env.ValueFrom.ConfigMapKeyRef != nil:
+			data, err := v.configMapData(ctx, env.ValueFrom.ConfigMapKeyRef.Name)
+			return data[env.ValueFrom.ConfigMapKeyRef.Key], true, err
+		default:
+			return "", true, nil
+		}
+	}
+
+	for _, envFrom := range container.EnvFrom {
+		if !strings.HasPrefix(name, envFrom.Prefix) {
+			continue
+		}
+
+		var data map[string]string
+		var err error
+		switch {
+		case envFrom.SecretRef != nil:
+			data, err = v.secretData(ctx, envFrom.SecretRef.Name)
+		case envFrom.ConfigMapRef != nil:
+			data, err = v.configMapData(ctx, envFrom.ConfigMapRef.Name)
+		}
+		if err != nil {
+			return "", false, err
+		}
+		if value, ok := data[strings.TrimPrefix(name, envFrom.Prefix)]; ok {
+			return value, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// validateSecretRefs checks if the Secrets which can define an environment variable of a container exist and contain the referenced key.
+// Optional references are not checked.
+func (v *storageValidator) validateSecretRefs(ctx context.Context, container corev1.Container, name string) error {
+	// variables of the env section take precedence over the envFrom section
+	for _, env := range container.Env {
+		if env.Name != name {
+			continue
+		}
+		if env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil || ptr.Deref(env.ValueFrom.SecretKeyRef.Optional, false) {
+			return nil
+		}
+
+		ref := env.ValueFrom.SecretKeyRef
+		data, err := v.secretData(ctx, ref.Name)
+		if err != nil {
+			return err
+		}
+		if _, ok := data[ref.Key]; data == nil {
+			v.addMissingReference("secret %s referenced by environment variable %s of container %s does not exist", ref.Name, env.Name, container.Name)
+		} else if !ok {
+			v.addMissingReference("secret %s referenced by environment variable %s of container %s does not contain the key %s", ref.Name, env.Name, container.Name, ref.Key)
+		}
+		return nil
+	}
+
+	for _, envFrom := range container.EnvFrom {
+		if envFrom.SecretRef == nil || ptr.Deref(envFrom.SecretRef.Optional, false) || !strings.HasPrefix(name, envFrom.Prefix) {
+			continue
+		}
+
+		data, err := v.secretData(ctx, envFrom.SecretRef.Name)
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			v.addMissingReference("secret %s referenced by container %s does not exist", envFrom.SecretRef.Name, container.Name)
+		}
+	}
+	return nil
+}
+
+// validateGCSCredentials checks if the credentials file referenced by the GOOGLE_APPLICATION_CREDENTIALS environment variable
+// is mounted in the Tempo containers. Without the environment variable, the credentials are provided by the workload identity.
+func (v *storageValidator) validateGCSCredentials(ctx context.Context) error {
+	for _, podSpec := range workloadPodSpecs(v.manifests) {
+		for _, container := range podSpec.Containers {
+			if !isTempoContainer(container) {
+				continue
+			}
+
+			err := v.validateSecretRefs(ctx, container, gcsCredentialsEnvVar)
+			if err != nil {
+				return err
+			}
+			file, defined, err := v.envVarValue(ctx, container, gcsCredentialsEnvVar)
+			if err != nil {
+				return err
+			}
+			if !defined || file == "" {
+				continue
+			}
+
+			err = v.validateMountedFile(ctx, podSpec, container, file, gcsCredentialsEnvVar)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateMountedFile checks if a file referenced by an environment variable is mounted in a container.
+// If the file is mounted from a Secret, the Secret must exist and contain the file.
+func (v *storageValidator) validateMountedFile(ctx context.Context, podSpec *corev1.PodSpec, container corev1.Container, file string, envVar string) error {
+	// the file is mounted by the volume mount with the longest matching mount path
+	var mount *corev1.VolumeMount
+	for i, m := range container.VolumeMounts {
+		if file != m.MountPath && !strings.HasPrefix(file, strings.TrimSuffix(m.MountPath, "/")+"/") {
+			continue
+		}
+		if mount == nil || len(m.MountPath) > len(mount.MountPath) {
+			mount = &container.VolumeMounts[i]
+		}
+	}
+	if mount == nil {
+		v.addProblem("file %s referenced by environment variable %s is not mounted in container %s", file, envVar, container.Name)
+		return nil
+	}
+
+	var secretVolume *corev1.SecretVolumeSource
+	for _, volume := range podSpec.Volumes {
+		if volume.Name == mount.Name {
+			secretVolume = volume.Secret
+		}
+	}
+	if secretVolume == nil || ptr.Deref(secretVolume.Optional, false) {
+		return nil
+	}
+
+	// the key of the file in the Secret is the path of the file in the volume, unless the keys are projected to different paths
+	key := strings.TrimPrefix(path.Join(mount.SubPath, strings.TrimPrefix(file, mount.MountPath)), "/")
+	if len(secretVolume.Items) > 0 {
+		projected := ""
+		for _, item := range secretVolume.Items {
+			if item.Path == key {
+				projected = item.Key
+			}
+		}
+		if projected == "" {
+			v.addProblem("file %s referenced by environment variable %s is not projected from secret %s in container %s", file, envVar, secretVolume.SecretName, container.Name)
+			return nil
+		}
+		key = projected
+	}
+
+	data, err := v.secretData(ctx, secretVolume.SecretName)
+	if err != nil {
+		return err
+	}
+	if _, ok := data[key]; data == nil {
+		v.addMissingReference("secret %s mounted in container %s does not exist", secretVolume.SecretName, container.Name)
+	} else if !ok {
+		v.addMissingReference("secret %s mounted in container %s does not contain the key %s", secretVolume.SecretName, container.Name, key)
+	}
+	return nil
+}
+
+// secretData returns the data of a Secret, or nil if the Secret does not exist.
+func (v *storageValidator) secretData(ctx context.Context, name string) (map[string]string, error) {
+	for _, obj := range v.manifests {
+		if secret, ok := obj.(*corev1.Secret); ok && secret.Name == name {
+			return secretStringData(secret), nil
+		}
+	}
+
+	secret := &corev1.Secret{}
+	err := v.client.Get(ctx, types.NamespacedName{Namespace: v.namespace, Name: name}, secret)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return secretStringData(secret), nil
+}
+
+// configMapData returns the data of a ConfigMap, or nil if the ConfigMap does not exist.
+func (v *storageValidator) configMapData(ctx context.Context, name string) (map[string]string, error) {
+	for _, obj := range v.manifests {
+		if cm, ok := obj.(*corev1.ConfigMap); ok && cm.Name == name {
+			return configMapStringData(cm), nil
+		}
+	}
+
+	cm := &corev1.ConfigMap{}
+	err := v.client.Get(ctx, types.NamespacedName{Namespace: v.namespace, Name: name}, cm)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return configMapStringData(cm), nil
+}
+
+func secretStringData(secret *corev1.Secret) map[string]string {
+	data := map[string]string{}
+	for key, value := range secret.Data {
+		data[key] = string(value)
+	}
+	for key, value := range secret.StringData {
+		data[key] = value
+	}
+	return data
+}
+
+func configMapStringData(cm *corev1.ConfigMap) map[string]string {
+	data := map[string]string{}
+	for key, value := range cm.Data {
+		data[key] = value
+	}
+	for key, value := range cm.BinaryData {
+		data[key] = string(value)
+	}
+	return data
+}
+
+// isSettingConfigured checks if a setting is set to a non-empty value.
+func isSettingConfigured(settings chartutil.Values, setting string) bool {
+	value, ok := settings[setting]
+	if !ok || value == nil {
+		return false
+	}
+	if s, ok := value.(string); ok {
+		return s != ""
+	}
+	return true
+}
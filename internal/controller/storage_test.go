@@ -0,0 +1,275 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/chartutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/status"
+)
+
+func TestValidateStorageConfig(t *testing.T) {
+	storageValues := func(backend string, settings map[string]interface{}) chartutil.Values {
+		return chartutil.Values{"storage": map[string]interface{}{"trace": map[string]interface{}{"backend": backend, backend: settings}}}
+	}
+	s3Settings := map[string]interface{}{"bucket": "tempo", "endpoint": "minio:9000"}
+	secretKeyRef := func(envVar string, secret string, key string) corev1.EnvVar {
+		return corev1.EnvVar{Name: envVar, ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secret}, Key: key},
+		}}
+	}
+	envFromSecret := func(secret string, prefix string) corev1.EnvFromSource {
+		return corev1.EnvFromSource{Prefix: prefix, SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: secret}}}
+	}
+	newSecret := func(name string, keys ...string) *corev1.Secret {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}, Data: map[string][]byte{}}
+		for _, key := range keys {
+			secret.Data[key] = []byte("value")
+		}
+		return secret
+	}
+	credentialsVolume := func(secret string, items ...corev1.KeyToPath) corev1.Volume {
+		return corev1.Volume{Name: "credentials", VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: secret, Items: items},
+		}}
+	}
+	credentialsMount := corev1.VolumeMount{Name: "credentials", MountPath: "/var/secrets/gcs"}
+
+	tests := []struct {
+		name       string
+		vals       chartutil.Values
+		container  corev1.Container
+		volumes    []corev1.Volume
+		objects    []client.Object
+		problems   string
+		retry      bool
+		noProblems bool
+	}{
+		{
+			name: "local backend",
+			vals: storageValues("local", nil),
+			container: corev1.Container{
+				Env: []corev1.EnvVar{secretKeyRef("UNRELATED", "missing", "key")},
+			},
+			noProblems: true,
+		},
+		{
+			name:     "unsupported backend",
+			vals:     storageValues("swift", nil),
+			problems: `unsupported backend "swift" in storage.trace.backend, supported backends are local, s3, gcs and azure`,
+		},
+		{
+			name:     "missing required settings",
+			vals:     storageValues("s3", map[string]interface{}{"bucket": "tempo"}),
+			problems: "storage.trace.s3.endpoint is not set",
+		},
+		{
+			name: "s3 with access keys",
+			vals: storageValues("s3", s3Settings),
+			container: corev1.Container{
+				Env: []corev1.EnvVar{
+					secretKeyRef("AWS_ACCESS_KEY_ID", "s3", "access_key"),
+					secretKeyRef("AWS_SECRET_ACCESS_KEY", "s3", "secret_key"),
+				},
+			},
+			objects:    []client.Object{newSecret("s3", "access_key", "secret_key")},
+			noProblems: true,
+		},
+		{
+			name: "s3 with the IAM role of the pod",
+			vals: storageValues("s3", s3Settings),
+			container: corev1.Container{
+				Env: []corev1.EnvVar{secretKeyRef("UNRELATED", "missing", "key")},
+			},
+			noProblems: true,
+		},
+		{
+			name: "s3 with a missing secret",
+			vals: storageValues("s3", s3Settings),
+			container: corev1.Container{
+				Env: []corev1.EnvVar{
+					secretKeyRef("AWS_ACCESS_KEY_ID", "s3", "access_key"),
+					secretKeyRef("AWS_SECRET_ACCESS_KEY", "s3", "secret_key"),
+				},
+			},
+			problems: "secret s3 referenced by environment variable AWS_ACCESS_KEY_ID of container tempo does not exist; " +
+				"secret s3 referenced by environment variable AWS_SECRET_ACCESS_KEY of container tempo does not exist",
+			retry: true,
+		},
+		{
+			name: "s3 with a missing key",
+			vals: storageValues("s3", s3Settings),
+			container: corev1.Container{
+				Env: []corev1.EnvVar{
+					secretKeyRef("AWS_ACCESS_KEY_ID", "s3", "access_key"),
+					secretKeyRef("AWS_SECRET_ACCESS_KEY", "s3", "secret_key"),
+				},
+			},
+			objects:  []client.Object{newSecret("s3", "access_key")},
+			problems: "secret s3 referenced by environment variable AWS_SECRET_ACCESS_KEY of container tempo does not contain the key secret_key",
+			retry:    true,
+		},
+		{
+			name:     "s3 with only one access key",
+			vals:     storageValues("s3", map[string]interface{}{"bucket": "tempo", "endpoint": "minio:9000", "access_key": "tempo"}),
+			problems: "storage.trace.s3.secret_key is not set, and the environment variable AWS_SECRET_ACCESS_KEY is not defined",
+		},
+		{
+			name: "s3 with credentials from envFrom with a prefix",
+			vals: storageValues("s3", s3Settings),
+			container: corev1.Container{
+				EnvFrom: []corev1.EnvFromSource{envFromSecret("unrelated", "OTHER_"), envFromSecret("s3", "AWS_")},
+			},
+			objects:    []client.Object{newSecret("s3", "ACCESS_KEY_ID", "SECRET_ACCESS_KEY")},
+			noProblems: true,
+		},
+		{
+			name: "s3 with credentials from a missing envFrom secret",
+			vals: storageValues("s3", s3Settings),
+			container: corev1.Container{
+				EnvFrom: []corev1.EnvFromSource{envFromSecret("s3", "AWS_")},
+			},
+			problems: "secret s3 referenced by container tempo does not exist",
+			retry:    true,
+		},
+		{
+			name: "s3 with a referenced environment variable",
+			vals: storageValues("s3", map[string]interface{}{"bucket": "${BUCKET}", "endpoint": "minio:9000"}),
+			container: corev1.Container{
+				Env: []corev1.EnvVar{secretKeyRef("BUCKET", "bucket", "name")},
+			},
+			problems: "secret bucket referenced by environment variable BUCKET of container tempo does not exist",
+			retry:    true,
+		},
+		{
+			name:     "s3 with an undefined environment variable",
+			vals:     storageValues("s3", map[string]interface{}{"bucket": "${BUCKET}", "endpoint": "minio:9000"}),
+			problems: "environment variable BUCKET referenced by storage.trace.s3.bucket is not defined in container tempo",
+		},
+		{
+			name:       "gcs with the workload identity",
+			vals:       storageValues("gcs", map[string]interface{}{"bucket_name": "tempo"}),
+			noProblems: true,
+		},
+		{
+			name: "gcs with a mounted credentials file",
+			vals: storageValues("gcs", map[string]interface{}{"bucket_name": "tempo"}),
+			container: corev1.Container{
+				Env:          []corev1.EnvVar{{Name: gcsCredentialsEnvVar, Value: "/var/secrets/gcs/key.json"}},
+				VolumeMounts: []corev1.VolumeMount{credentialsMount},
+			},
+			volumes:    []corev1.Volume{credentialsVolume("gcs")},
+			objects:    []client.Object{newSecret("gcs", "key.json")},
+			noProblems: true,
+		},
+		{
+			name: "gcs with a projected credentials file",
+			vals: storageValues("gcs", map[string]interface{}{"bucket_name": "tempo"}),
+			container: corev1.Container{
+				Env:          []corev1.EnvVar{{Name: gcsCredentialsEnvVar, Value: "/var/secrets/gcs/key.json"}},
+				VolumeMounts: []corev1.VolumeMount{credentialsMount},
+			},
+			volumes:    []corev1.Volume{credentialsVolume("gcs", corev1.KeyToPath{Key: "credentials", Path: "key.json"})},
+			objects:    []client.Object{newSecret("gcs", "credentials")},
+			noProblems: true,
+		},
+		{
+			name: "gcs with a credentials file which is not mounted",
+			vals: storageValues("gcs", map[string]interface{}{"bucket_name": "tempo"}),
+			container: corev1.Container{
+				Env: []corev1.EnvVar{{Name: gcsCredentialsEnvVar, Value: "/var/secrets/gcs/key.json"}},
+			},
+			problems: "file /var/secrets/gcs/key.json referenced by environment variable GOOGLE_APPLICATION_CREDENTIALS is not mounted in container tempo",
+		},
+		{
+			name: "gcs with a missing credentials secret",
+			vals: storageValues("gcs", map[string]interface{}{"bucket_name": "tempo"}),
+			container: corev1.Container{
+				Env:          []corev1.EnvVar{{Name: gcsCredentialsEnvVar, Value: "/var/secrets/gcs/key.json"}},
+				VolumeMounts: []corev1.VolumeMount{credentialsMount},
+			},
+			volumes:  []corev1.Volume{credentialsVolume("gcs")},
+			problems: "secret gcs mounted in container tempo does not exist",
+			retry:    true,
+		},
+		{
+			name: "gcs with a missing key",
+			vals: storageValues("gcs", map[string]interface{}{"bucket_name": "tempo"}),
+			container: corev1.Container{
+				Env:          []corev1.EnvVar{{Name: gcsCredentialsEnvVar, Value: "/var/secrets/gcs/key.json"}},
+				VolumeMounts: []corev1.VolumeMount{credentialsMount},
+			},
+			volumes:  []corev1.Volume{credentialsVolume("gcs")},
+			objects:  []client.Object{newSecret("gcs", "credentials.json")},
+			problems: "secret gcs mounted in container tempo does not contain the key key.json",
+			retry:    true,
+		},
+		{
+			name: "azure with a storage account key",
+			vals: storageValues("azure", map[string]interface{}{"container_name": "tempo", "storage_account_name": "tempo"}),
+			container: corev1.Container{
+				Env: []corev1.EnvVar{secretKeyRef("AZURE_STORAGE_KEY", "azure", "key")},
+			},
+			objects:    []client.Object{newSecret("azure", "key")},
+			noProblems: true,
+		},
+		{
+			name:     "azure without a storage account key",
+			vals:     storageValues("azure", map[string]interface{}{"container_name": "tempo", "storage_account_name": "tempo"}),
+			problems: "storage.trace.azure.storage_account_key is not set, and the environment variable AZURE_STORAGE_KEY is not defined",
+		},
+		{
+			name: "azure with a managed identity",
+			vals: storageValues("azure", map[string]interface{}{
+				"container_name":       "tempo",
+				"storage_account_name": "tempo",
+				"use_managed_identity": true,
+			}),
+			noProblems: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			tempo := v1alpha1.TempoMicroservices{ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "default"}}
+			container := test.container
+			container.Name = "tempo"
+			container.Args = []string{"-target=distributor"}
+			manifests := []client.Object{&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "tempo-distributor", Namespace: "default"},
+				Spec: appsv1.DeploymentSpec{
+					Replicas: ptr.To(int32(1)),
+					Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+						Containers: []corev1.Container{container},
+						Volumes:    test.volumes,
+					}},
+				},
+			}}
+			k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(test.objects...).Build()
+
+			err := validateStorageConfig(context.Background(), k8sclient, tempo, test.vals, manifests)
+			if test.noProblems {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+
+			var cerr *status.ConfigurationError
+			g.Expect(errors.As(err, &cerr)).To(BeTrue())
+			g.Expect(cerr.Reason).To(Equal(v1alpha1.ReasonInvalidStorageConfig))
+			g.Expect(cerr.Message).To(Equal(test.problems))
+			g.Expect(cerr.Retry).To(Equal(test.retry))
+		})
+	}
+}
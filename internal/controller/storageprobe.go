@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/status"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/storageprobe"
+)
+
+// newS3ProbeConfig returns the settings of the s3 storage backend, with the credentials resolved from the environment of a Tempo container.
+// Returns nil if the backend is not s3, or if no access keys are configured (i.e. the credentials are provided by the IAM role of the pods).
+func newS3ProbeConfig(ctx context.Context, k8sclient client.Client, tempo v1alpha1.TempoMicroservices, vals chartutil.Values, manifests []client.Object) (*storageprobe.S3Config, error) {
+	backend, _ := vals.PathValue("storage.trace.backend")
+	containers := tempoContainers(manifests)
+	if backend != "s3" || len(containers) == 0 {
+		return nil, nil
+	}
+
+	settings, err := vals.Table("storage.trace.s3")
+	if err != nil {
+		settings = chartutil.Values{}
+	}
+
+	v := &storageValidator{
+		client:    k8sclient,
+		namespace: tempo.GetNamespace(),
+		manifests: manifests,
+	}
+	container := containers[0]
+	var lookupErr error
+	lookupEnv := func(name string) string {
+		value, _, err := v.envVarValue(ctx, container, name)
+		if err != nil {
+			lookupErr = err
+		}
+		return value
+	}
+
+	// environment variables in the configuration are expanded by Tempo only if the -config.expand-env flag is set
+	expandEnv := slices.Contains(container.Args, "-config.expand-env=true")
+	stringSetting := func(setting string, envVar string) string {
+		value, _ := settings[setting].(string)
+		if value == "" && envVar != "" {
+			return lookupEnv(envVar)
+		}
+		if expandEnv {
+			return os.Expand(value, lookupEnv)
+		}
+		return value
+	}
+	boolSetting := func(setting string) bool {
+		value, _ := settings[setting].(bool)
+		return value
+	}
+
+	cfg := &storageprobe.S3Config{
+		Bucket:             stringSetting("bucket", ""),
+		Prefix:             stringSetting("prefix", ""),
+		Endpoint:           stringSetting("endpoint", ""),
+		Region:             stringSetting("region", ""),
+		AccessKey:          stringSetting("access_key", "AWS_ACCESS_KEY_ID"),
+		SecretKey:          stringSetting("secret_key", "AWS_SECRET_ACCESS_KEY"),
+		SessionToken:       stringSetting("session_token", "AWS_SESSION_TOKEN"),
+		Insecure:           boolSetting("insecure"),
+		InsecureSkipVerify: boolSetting("insecure_skip_verify"),
+		ForcePathStyle:     boolSetting("forcepathstyle"),
+	}
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, nil
+	}
+	return cfg, nil
+}
+
+// storageProbeRetryInterval is the interval for retrying a failed storage probe, if the helm values did not change.
+const storageProbeRetryInterval = time.Minute
+
+// storageProbeFailure is a failed storage probe of an instance.
+type storageProbeFailure struct {
+	time       time.Time
+	valuesHash string
+}
+
+// storageProbeFailures tracks the last failed storage probe of each instance, to rate-limit the retries of failed probes.
+type storageProbeFailures struct {
+	mu       sync.Mutex
+	failures map[types.NamespacedName]storageProbeFailure
+}
+
+// retryAfter returns the remaining time until a failed probe of the same helm values can be retried, or zero if the probe can run.
+func (f *storageProbeFailures) retryAfter(key types.NamespacedName, valuesHash string, now time.Time) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	failure, ok := f.failures[key]
+	if !ok || failure.valuesHash != valuesHash {
+		return 0
+	}
+	return max(failure.time.Add(storageProbeRetryInterval).Sub(now), 0)
+}
+
+// record records the result of a storage probe.
+func (f *storageProbeFailures) record(key types.NamespacedName, valuesHash string, now time.Time, probeErr error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if probeErr == nil {
+		delete(f.failures, key)
+		return
+	}
+	if f.failures == nil {
+		f.failures = map[types.NamespacedName]storageProbeFailure{}
+	}
+	f.failures[key] = storageProbeFailure{time: now, valuesHash: valuesHash}
+}
+
+// probeStorage checks if the trace storage can be accessed with the credentials of the Tempo components, and sets the StorageUnreachable condition.
+// The probe runs if the helm values changed since the last applied release, or if the previous probe did not succeed.
+// A failed probe is retried after storageProbeRetryInterval, unless the helm values changed. Returns the time until the next retry.
+// The condition is removed if the probe is disabled or the local backend is used, and set to unknown if the storage backend
+// or its credentials are not supported by the probe.
+func probeStorage(
+	ctx context.Context,
+	k8sclient client.Client,
+	failures *storageProbeFailures,
+	tempo v1alpha1.TempoMicroservices,
+	vals chartutil.Values,
+	manifests []client.Object,
+	newStatus *v1alpha1.TempoMicroservicesStatus,
+) (time.Duration, error) {
+	backend, _ := vals.PathValue("storage.trace.backend")
+	if !tempo.Spec.StorageProbe.Enabled || backend == "local" {
+		meta.RemoveStatusCondition(&newStatus.Conditions, string(v1alpha1.ConditionStorageUnreachable))
+		return 0, nil
+	}
+	if backend != "s3" {
+		status.SetStorageProbeSkippedCondition(&newStatus.Conditions, fmt.Sprintf("The storage probe does not support the %s backend", backend))
+		return 0, nil
+	}
+
+	cfg, err := newS3ProbeConfig(ctx, k8sclient, tempo, vals, manifests)
+	if err != nil {
+		return 0, err
+	}
+	if cfg == nil {
+		status.SetStorageProbeSkippedCondition(&newStatus.Conditions, "The storage probe does not support s3 credentials provided by the IAM role of the pods")
+		return 0, nil
+	}
+
+	hash, err := valuesHash(vals)
+	if err != nil {
+		return 0, err
+	}
+	previous := meta.FindStatusCondition(newStatus.Conditions, string(v1alpha1.ConditionStorageUnreachable))
+	if hash == newStatus.ValuesHash && previous != nil && previous.Status == metav1.ConditionFalse {
+		return 0, nil
+	}
+
+	key := client.ObjectKeyFromObject(&tempo)
+	now := time.Now()
+	if previous != nil && previous.Status == metav1.ConditionTrue {
+		if retryAfter := failures.retryAfter(key, hash, now); retryAfter > 0 {
+			return retryAfter, nil
+		}
+	}
+
+	err = storageprobe.ProbeS3(ctx, *cfg)
+	failures.record(key, hash, now, err)
+	status.SetStorageUnreachableCondition(&newStatus.Conditions, err)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "trace storage is unreachable", "bucket", cfg.Bucket, "endpoint", cfg.Endpoint)
+		return storageProbeRetryInterval, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/chartutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+func TestStorageProbeFailures(t *testing.T) {
+	g := NewWithT(t)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	key := types.NamespacedName{Namespace: "default", Name: "simplest"}
+	failures := &storageProbeFailures{}
+
+	g.Expect(failures.retryAfter(key, "hash", now)).To(BeZero())
+
+	failures.record(key, "hash", now, errors.New("access denied"))
+	g.Expect(failures.retryAfter(key, "hash", now.Add(10*time.Second))).To(Equal(storageProbeRetryInterval - 10*time.Second))
+	g.Expect(failures.retryAfter(key, "hash", now.Add(storageProbeRetryInterval))).To(BeZero())
+	g.Expect(failures.retryAfter(key, "changed", now)).To(BeZero())
+	g.Expect(failures.retryAfter(types.NamespacedName{Namespace: "default", Name: "other"}, "hash", now)).To(BeZero())
+
+	failures.record(key, "hash", now, nil)
+	g.Expect(failures.retryAfter(key, "hash", now)).To(BeZero())
+}
+
+func TestProbeStorage(t *testing.T) {
+	s3Values := func(settings map[string]interface{}) chartutil.Values {
+		settings["bucket"] = "tempo"
+		settings["endpoint"] = "minio:9000"
+		return chartutil.Values{"storage": map[string]interface{}{"trace": map[string]interface{}{"backend": "s3", "s3": settings}}}
+	}
+	manifests := []client.Object{&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "tempo-distributor", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "tempo", Args: []string{"-target=distributor"}}},
+			}},
+		},
+	}}
+
+	tests := []struct {
+		name           string
+		enabled        bool
+		vals           chartutil.Values
+		failedProbe    bool
+		expectedReason v1alpha1.ConditionReason
+		requeue        bool
+	}{
+		{
+			name:    "disabled",
+			enabled: false,
+			vals:    s3Values(map[string]interface{}{}),
+		},
+		{
+			name:    "local backend",
+			enabled: true,
+			vals:    chartutil.Values{"storage": map[string]interface{}{"trace": map[string]interface{}{"backend": "local"}}},
+		},
+		{
+			name:           "gcs backend",
+			enabled:        true,
+			vals:           chartutil.Values{"storage": map[string]interface{}{"trace": map[string]interface{}{"backend": "gcs"}}},
+			expectedReason: v1alpha1.ReasonStorageProbeSkipped,
+		},
+		{
+			name:           "s3 with the IAM role of the pods",
+			enabled:        true,
+			vals:           s3Values(map[string]interface{}{}),
+			expectedReason: v1alpha1.ReasonStorageProbeSkipped,
+		},
+		{
+			name:           "failed probe is not retried immediately",
+			enabled:        true,
+			vals:           s3Values(map[string]interface{}{"access_key": "tempo", "secret_key": "supersecret"}),
+			failedProbe:    true,
+			expectedReason: v1alpha1.ReasonAccessDenied,
+			requeue:        true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+			tempo := v1alpha1.TempoMicroservices{
+				ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "default"},
+				Spec:       v1alpha1.TempoMicroservicesSpec{StorageProbe: v1alpha1.StorageProbeSpec{Enabled: test.enabled}},
+			}
+			newStatus := &v1alpha1.TempoMicroservicesStatus{
+				Conditions: []metav1.Condition{{
+					Type:   string(v1alpha1.ConditionStorageUnreachable),
+					Reason: string(v1alpha1.ReasonAccessDenied),
+					Status: metav1.ConditionTrue,
+				}},
+			}
+			failures := &storageProbeFailures{}
+			if test.failedProbe {
+				hash, err := valuesHash(test.vals)
+				g.Expect(err).NotTo(HaveOccurred())
+				failures.record(client.ObjectKeyFromObject(&tempo), hash, time.Now(), errors.New("access denied"))
+			}
+			k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+			requeueAfter, err := probeStorage(ctx, k8sclient, failures, tempo, test.vals, manifests, newStatus)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(requeueAfter > 0).To(Equal(test.requeue))
+
+			condition := meta.FindStatusCondition(newStatus.Conditions, string(v1alpha1.ConditionStorageUnreachable))
+			if test.expectedReason == "" {
+				g.Expect(condition).To(BeNil())
+				return
+			}
+			g.Expect(condition).NotTo(BeNil())
+			g.Expect(condition.Reason).To(Equal(string(test.expectedReason)))
+			if test.expectedReason == v1alpha1.ReasonStorageProbeSkipped {
+				g.Expect(condition.Status).To(Equal(metav1.ConditionUnknown))
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/status"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/tempoapi"
+)
+
+const (
+	componentLabel         = "app.kubernetes.io/component"
+	ingesterComponent      = "ingester"
+	distributorComponent   = "distributor"
+	queryFrontendComponent = "query-frontend"
+)
+
+// healthProbeInterval is the interval for probing the Tempo components if health probes are enabled.
+// The result of the probes is not observable via watches.
+const healthProbeInterval = time.Minute
+
+func componentOf(obj client.Object) string {
+	return obj.GetLabels()[componentLabel]
+}
+
+// tempoAPI contains the clients for the HTTP API of the Tempo components of an instance.
+type tempoAPI struct {
+	ingester       *tempoapi.Client
+	distributor    *tempoapi.Client
+	distributorURL string
+
+	// podURL returns the URL of the HTTP API of a pod
+	podURL func(pod *corev1.Pod) string
+}
+
+// newTempoAPI creates the clients for the HTTP API of the Tempo components, which connect with mTLS if TLS is enabled.
+func newTempoAPI(tempo v1alpha1.TempoMicroservices, vals chartutil.Values, manifests []client.Object) (*tempoAPI, error) {
+	ingesterTLSConfig, err := componentTLSConfig(tempo, vals, manifests, ingesterComponent)
+	if err != nil {
+		return nil, err
+	}
+	distributorTLSConfig, err := componentTLSConfig(tempo, vals, manifests, distributorComponent)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "http"
+	if ingesterTLSConfig != nil {
+		scheme = "https"
+	}
+	distributorURL, err := componentServiceURL(manifests, distributorComponent, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tempoAPI{
+		ingester:       tempoapi.NewClient(ingesterTLSConfig),
+		distributor:    tempoapi.NewClient(distributorTLSConfig),
+		distributorURL: distributorURL,
+		podURL: func(pod *corev1.Pod) string {
+			return fmt.Sprintf("%s://%s:%d", scheme, pod.Status.PodIP, tempoapi.HTTPPort)
+		},
+	}, nil
+}
+
+// componentServiceURL returns the URL of the HTTP API of the service of a component.
+func componentServiceURL(manifests []client.Object, component string, scheme string) (string, error) {
+	for _, obj := range manifests {
+		svc, ok := obj.(*corev1.Service)
+		if ok && componentOf(svc) == component && svc.Spec.ClusterIP != corev1.ClusterIPNone {
+			return fmt.Sprintf("%s://%s.%s.svc:%d", scheme, svc.Name, svc.Namespace, tempoapi.HTTPPort), nil
+		}
+	}
+	return "", fmt.Errorf("%s service not found", component)
+}
+
+// newServingProbe creates the probe of the HTTP endpoints of the query-frontend and distributor,
+// which connects with mTLS if TLS is enabled.
+func newServingProbe(tempo v1alpha1.TempoMicroservices, vals chartutil.Values, manifests []client.Object) (*status.ServingProbe, error) {
+	queryFrontendTLSConfig, err := componentTLSConfig(tempo, vals, manifests, queryFrontendComponent)
+	if err != nil {
+		return nil, err
+	}
+	distributorTLSConfig, err := componentTLSConfig(tempo, vals, manifests, distributorComponent)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "http"
+	if distributorTLSConfig != nil {
+		scheme = "https"
+	}
+	queryFrontendURL, err := componentServiceURL(manifests, queryFrontendComponent, scheme)
+	if err != nil {
+		return nil, err
+	}
+	distributorURL, err := componentServiceURL(manifests, distributorComponent, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	return &status.ServingProbe{
+		QueryFrontend:    tempoapi.NewClient(queryFrontendTLSConfig),
+		QueryFrontendURL: queryFrontendURL,
+		Distributor:      tempoapi.NewClient(distributorTLSConfig),
+		DistributorURL:   distributorURL,
+	}, nil
+}
+
+func (a *tempoAPI) ingesterRing(ctx context.Context) (*tempoapi.Ring, error) {
+	return a.distributor.IngesterRing(ctx, a.distributorURL)
+}
@@ -4,19 +4,29 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
 
 	helmclient "github.com/operator-framework/helm-operator-plugins/pkg/client"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	networkingv1 "k8s.io/api/networking/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	tempov1alpha1 "github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
 	"github.com/andreasgerstmayr/tempo-helm-operator/internal/status"
@@ -28,11 +38,24 @@ type TempoMicroservicesReconciler struct {
 	Scheme             *runtime.Scheme
 	ActionConfigGetter helmclient.ActionConfigGetter
 	ActionClientGetter helmclient.ActionClientGetter
+	Recorder           record.EventRecorder
+
+	controller controller.Controller
+	cache      cache.Cache
+	mapper     meta.RESTMapper
+	watchesMu  sync.Mutex
+	watches    sets.Set[schema.GroupVersionKind]
+
+	storageProbeFailures storageProbeFailures
 }
 
 //+kubebuilder:rbac:groups=tempo.grafana.com,resources=tempomicroservices,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=tempo.grafana.com,resources=tempomicroservices/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=tempo.grafana.com,resources=tempomicroservices/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch;delete
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -52,58 +75,293 @@ func (r *TempoMicroservicesReconciler) Reconcile(ctx context.Context, req ctrl.R
 		return ctrl.Result{}, nil
 	}
 
+	newStatus := tempo.Status.DeepCopy()
+	result, probe, err := r.reconcile(ctx, tempo, newStatus)
+
+	// Note: controller-runtime will always requeue a reconcile if Reconcile() returns any error except TerminalError.
+	// Result.Requeue and Result.RequeueAfter are only respected if err == nil
+	// https://github.com/kubernetes-sigs/controller-runtime/blob/v0.15.0/pkg/internal/controller/controller.go#L315-L341
+	return result, status.HandleStatus(ctx, r.Client, r.Recorder, tempo, *newStatus, probe, err)
+}
+
+// reconcile renders the helm chart and applies the manifests, or computes the pending changes
+// if the management state is set to Preview.
+// Status fields computed during the reconciliation are stored in newStatus.
+// If health probes are enabled, the probe of the Tempo components is returned.
+func (r *TempoMicroservicesReconciler) reconcile(ctx context.Context, tempo tempov1alpha1.TempoMicroservices, newStatus *tempov1alpha1.TempoMicroservicesStatus) (ctrl.Result, *status.ServingProbe, error) {
+	if tempo.Spec.ManagementState == tempov1alpha1.ManagementStateUnmanaged {
+		log.FromContext(ctx).V(1).Info("skipping reconciliation for unmanaged TempoMicroservices resource", "name", tempo.Name)
+		newStatus.PendingChanges = nil
+		return ctrl.Result{}, nil, nil
+	}
+
 	chart, err := loader.Load("helm-charts/tempo-distributed")
 	if err != nil {
-		return ctrl.Result{}, status.HandleStatus(ctx, r.Client, tempo, err)
+		return ctrl.Result{}, nil, err
 	}
 
 	var vals chartutil.Values
 	err = json.Unmarshal(tempo.Spec.Values.Raw, &vals)
 	if err != nil {
-		return ctrl.Result{}, status.HandleStatus(ctx, r.Client, tempo, err)
+		return ctrl.Result{}, nil, err
 	}
 
 	// merge values from CR with default values of chart
 	vals, err = chartutil.CoalesceValues(chart, vals)
 	if err != nil {
-		return ctrl.Result{}, status.HandleStatus(ctx, r.Client, tempo, err)
+		return ctrl.Result{}, nil, err
+	}
+
+	zoneAwareness := tempo.Spec.ZoneAwareness.Enabled && len(tempo.Spec.ZoneAwareness.Zones) > 0
+	if zoneAwareness {
+		err = validateZones(tempo.Spec.ZoneAwareness)
+		if err != nil {
+			return ctrl.Result{}, nil, err
+		}
+		setZoneAwarenessValues(vals)
 	}
 
 	manifests, err := r.renderHelmChart(chart, &tempo, vals)
 	if err != nil {
-		return ctrl.Result{}, status.HandleStatus(ctx, r.Client, tempo, err)
+		r.Recorder.Eventf(&tempo, corev1.EventTypeWarning, "RenderFailed", "Failed to render the helm chart: %v", err)
+		return ctrl.Result{}, nil, err
+	}
+	if zoneAwareness {
+		manifests, err = splitIngesterZones(manifests, tempo.Spec.ZoneAwareness)
+		if err != nil {
+			return ctrl.Result{}, nil, err
+		}
+	}
+
+	err = r.ensureWatches(ctx, manifests)
+	if err != nil {
+		return ctrl.Result{}, nil, err
 	}
 
+	var issuedCerts []issuedCertificate
 	mtlsEnabled, _ := vals.PathValue("server.tls.enabled")
 	if mtlsEnabled == true {
-		certs, err := createCerts(ctx, r.Client, tempo)
+		var certs []client.Object
+		certs, issuedCerts, err = createCerts(ctx, r.Client, tempo)
 		if err != nil {
-			return ctrl.Result{}, status.HandleStatus(ctx, r.Client, tempo, err)
+			return ctrl.Result{}, nil, err
 		}
 		manifests = append(manifests, certs...)
 	}
 
-	err = reconcileManagedObjects(context.Background(), r.Client, &tempo, r.Scheme, manifests, map[types.UID]client.Object{})
+	err = validateStorageConfig(ctx, r.Client, tempo, vals, manifests)
 	if err != nil {
-		return ctrl.Result{}, status.HandleStatus(ctx, r.Client, tempo, err)
+		return ctrl.Result{}, nil, err
 	}
 
-	// Note: controller-runtime will always requeue a reconcile if Reconcile() returns any error except TerminalError.
-	// Result.Requeue and Result.RequeueAfter are only respected if err == nil
-	// https://github.com/kubernetes-sigs/controller-runtime/blob/v0.15.0/pkg/internal/controller/controller.go#L315-L341
-	return ctrl.Result{}, status.HandleStatus(ctx, r.Client, tempo, nil)
+	if tempo.Spec.IngesterRolloutStrategy == tempov1alpha1.IngesterRolloutStrategyGraceful {
+		setOnDeleteUpdateStrategy(manifests)
+	}
+
+	err = annotateConfigHashes(manifests, manifests)
+	if err != nil {
+		return ctrl.Result{}, nil, err
+	}
+
+	err = annotateTemplateHashes(manifests)
+	if err != nil {
+		return ctrl.Result{}, nil, err
+	}
+
+	// owned objects which are not rendered anymore are only deleted (or reported as deletions in preview) if pruning is enabled
+	ownedObjects := map[types.UID]client.Object{}
+	if tempo.Spec.Pruning.Enabled {
+		kinds, err := r.ownedKinds(manifests)
+		if err != nil {
+			return ctrl.Result{}, nil, err
+		}
+		ownedObjects, err = getOwnedObjects(ctx, r.Client, &tempo, kinds)
+		if err != nil {
+			return ctrl.Result{}, nil, err
+		}
+	}
+
+	if tempo.Spec.ManagementState == tempov1alpha1.ManagementStatePreview {
+		newStatus.PendingChanges, err = previewManagedObjects(ctx, r.Client, &tempo, r.Scheme, manifests, ownedObjects)
+		return ctrl.Result{}, nil, err
+	}
+
+	newStatus.PendingChanges = nil
+	result := ctrl.Result{}
+
+	// ingester StatefulSets which are not rendered anymore are scaled down gracefully, even if pruning is disabled
+	manifests, err = retireIngesterStatefulSets(ctx, r.Client, &tempo, manifests, ownedObjects)
+	if err != nil {
+		return ctrl.Result{}, nil, err
+	}
+
+	// the trace storage is probed before applying the manifests, a failed probe is reported but does not block the reconciliation
+	requeueAfter, err := probeStorage(ctx, r.Client, &r.storageProbeFailures, tempo, vals, manifests, newStatus)
+	if err != nil {
+		return ctrl.Result{}, nil, err
+	}
+	result.RequeueAfter = minRequeueAfter(result.RequeueAfter, requeueAfter)
+
+	// disruptive changes are applied only inside a maintenance window, if maintenance windows are configured
+	newStatus.DeferredChanges = nil
+	newStatus.NextMaintenanceWindow = nil
+	if len(tempo.Spec.MaintenanceWindows) > 0 {
+		schedules, err := parseMaintenanceWindows(tempo.Spec.MaintenanceWindows)
+		if err != nil {
+			return ctrl.Result{}, nil, err
+		}
+
+		now := time.Now()
+		if !inMaintenanceWindow(schedules, now) {
+			// certificates which expire before they could be rotated in the next maintenance window are rotated immediately
+			next := nextMaintenanceWindow(schedules, now)
+			deadline := next.Add(certificateRotationMargin)
+
+			var deferredObjects map[types.UID]client.Object
+			manifests, deferredObjects, newStatus.DeferredChanges, err = deferDisruptiveChanges(ctx, r.Client, &tempo, r.Scheme, manifests, deadline)
+			if err != nil {
+				return ctrl.Result{}, nil, err
+			}
+
+			// the live objects of deferred changes must not be pruned
+			for uid := range deferredObjects {
+				delete(ownedObjects, uid)
+			}
+
+			if len(newStatus.DeferredChanges) > 0 {
+				newStatus.NextMaintenanceWindow = &metav1.Time{Time: next}
+				result.RequeueAfter = next.Sub(now)
+			}
+		}
+	}
+
+	// the HTTP API of the Tempo components is used for the maintenance of the ingesters
+	var api *tempoAPI
+	var apiErr error
+	if len(ingesterStatefulSets(manifests)) > 0 {
+		api, apiErr = newTempoAPI(tempo, vals, manifests)
+		if apiErr != nil {
+			// the maintenance of the ingesters is paused until the API is available, the other objects are still reconciled
+			log.FromContext(ctx).Error(apiErr, "cannot create the clients for the HTTP API of the Tempo components")
+			result.RequeueAfter = minRequeueAfter(result.RequeueAfter, rolloutRequeueInterval)
+		}
+
+		scaleDown, err := scaleDownIngesters(ctx, r.Client, api, manifests)
+		if err != nil {
+			return ctrl.Result{}, nil, err
+		}
+		status.SetScalingDownCondition(&newStatus.Conditions, scaleDown)
+		if scaleDown != "" {
+			result.RequeueAfter = minRequeueAfter(result.RequeueAfter, rolloutRequeueInterval)
+		}
+
+		err = holdZoneRollouts(ctx, r.Client, manifests)
+		if err != nil {
+			return ctrl.Result{}, nil, err
+		}
+	}
+
+	var applied bool
+	newStatus.UserOwnedObjects, applied, err = reconcileManagedObjects(ctx, r.Client, &tempo, r.Scheme, r.Recorder, manifests, ownedObjects)
+	if err != nil {
+		return ctrl.Result{}, nil, err
+	}
+
+	recordIssuedCertificates(r.Recorder, &tempo, manifests, issuedCerts)
+
+	if !applied {
+		// the remaining phases are applied once the workloads of the held phase are ready
+		result.RequeueAfter = minRequeueAfter(result.RequeueAfter, rolloutRequeueInterval)
+	}
+
+	newStatus.VolumeExpansions, err = getVolumeExpansions(ctx, r.Client, manifests)
+	if err != nil {
+		return ctrl.Result{}, nil, err
+	}
+
+	if api != nil {
+		ring, err := api.ingesterRing(ctx)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "cannot read the ingester ring")
+		}
+		status.SetRingStatus(newStatus, ring, err)
+	} else {
+		status.SetRingStatus(newStatus, nil, apiErr)
+	}
+
+	var probe *status.ServingProbe
+	if tempo.Spec.HealthProbes.Enabled {
+		probe, err = newServingProbe(tempo, vals, manifests)
+		if err != nil {
+			return ctrl.Result{}, nil, err
+		}
+		result.RequeueAfter = minRequeueAfter(result.RequeueAfter, healthProbeInterval)
+	}
+
+	// the release is not fully applied while disruptive changes are deferred, or a readiness gate holds back objects
+	if applied && len(newStatus.DeferredChanges) == 0 {
+		newStatus.ValuesHash, err = valuesHash(vals)
+		if err != nil {
+			return ctrl.Result{}, nil, err
+		}
+		newStatus.ChartVersion = chart.Metadata.Version
+		newStatus.TempoVersion = tempoVersion(manifests)
+	}
+
+	if api != nil && tempo.Spec.RingCleanup.Enabled {
+		requeueAfter, err := cleanupRing(ctx, r.Client, r.Recorder, &tempo, api, newStatus)
+		if err != nil {
+			return ctrl.Result{}, nil, err
+		}
+		result.RequeueAfter = minRequeueAfter(result.RequeueAfter, requeueAfter)
+	} else {
+		newStatus.StaleRingInstances = nil
+	}
+
+	if api != nil && tempo.Spec.IngesterRolloutStrategy == tempov1alpha1.IngesterRolloutStrategyGraceful {
+		rollout := &ingesterRollout{client: r.Client, api: api}
+		inProgress, err := rollout.run(ctx, manifests)
+		if err != nil {
+			return ctrl.Result{}, nil, err
+		}
+		if inProgress {
+			result.RequeueAfter = minRequeueAfter(result.RequeueAfter, rolloutRequeueInterval)
+		}
+	}
+	return result, probe, nil
+}
+
+// minRequeueAfter returns the shorter requeue interval, ignoring unset (zero) intervals.
+func minRequeueAfter(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
 }
 
 // SetupWithManager sets up the controller with the Manager.
+// Additional kinds rendered by the helm chart are watched once they are rendered, see ensureWatches().
 func (r *TempoMicroservicesReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&tempov1alpha1.TempoMicroservices{}).
-		Owns(&corev1.ConfigMap{}).
-		Owns(&corev1.Secret{}).
-		Owns(&corev1.Service{}).
-		Owns(&corev1.ServiceAccount{}).
-		Owns(&appsv1.Deployment{}).
-		Owns(&appsv1.StatefulSet{}).
-		Owns(&networkingv1.Ingress{}).
-		Complete(r)
+	// updates of the status and metadata of the TempoMicroservices resource do not require a reconciliation
+	builder := ctrl.NewControllerManagedBy(mgr).
+		For(&tempov1alpha1.TempoMicroservices{}, ctrlbuilder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	r.watches = sets.New[schema.GroupVersionKind]()
+	for _, obj := range ownedTypes() {
+		gvk, err := apiutil.GVKForObject(obj, mgr.GetScheme())
+		if err != nil {
+			return err
+		}
+		builder = builder.Owns(obj)
+		r.watches.Insert(gvk)
+	}
+
+	c, err := builder.Build(r)
+	if err != nil {
+		return err
+	}
+
+	r.controller = c
+	r.cache = mgr.GetCache()
+	r.mapper = mgr.GetRESTMapper()
+	return nil
 }
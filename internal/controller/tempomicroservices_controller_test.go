@@ -18,11 +18,17 @@ package controller
 
 import (
 	"context"
+	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -69,8 +75,9 @@ var _ = Describe("TempoMicroservices Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &TempoMicroservicesReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
@@ -82,3 +89,42 @@ var _ = Describe("TempoMicroservices Controller", func() {
 		})
 	})
 })
+
+func TestReconcileUnmanaged(t *testing.T) {
+	g := NewWithT(t)
+
+	tempo := tempov1alpha1.TempoMicroservices{
+		ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "default"},
+		Spec:       tempov1alpha1.TempoMicroservicesSpec{ManagementState: tempov1alpha1.ManagementStateUnmanaged},
+	}
+	writes := 0
+	countWrite := func() error {
+		writes++
+		return nil
+	}
+	k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(context.Context, client.WithWatch, client.Object, ...client.CreateOption) error {
+			return countWrite()
+		},
+		Update: func(context.Context, client.WithWatch, client.Object, ...client.UpdateOption) error {
+			return countWrite()
+		},
+		Patch: func(context.Context, client.WithWatch, client.Object, client.Patch, ...client.PatchOption) error {
+			return countWrite()
+		},
+		Delete: func(context.Context, client.WithWatch, client.Object, ...client.DeleteOption) error {
+			return countWrite()
+		},
+	}).Build()
+	r := &TempoMicroservicesReconciler{Client: k8sclient, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(10)}
+
+	newStatus := &tempov1alpha1.TempoMicroservicesStatus{
+		PendingChanges: []tempov1alpha1.PendingChange{{Kind: "ConfigMap", Name: "tempo", Action: tempov1alpha1.PendingChangeUpdate}},
+	}
+	result, probe, err := r.reconcile(context.Background(), tempo, newStatus)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal(reconcile.Result{}))
+	g.Expect(probe).To(BeNil())
+	g.Expect(writes).To(BeZero())
+	g.Expect(newStatus.PendingChanges).To(BeNil())
+}
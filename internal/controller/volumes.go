@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+// volumeClaimTemplatesExpanded checks if the only change of the volumeClaimTemplates is an increase of the requested storage.
+func volumeClaimTemplatesExpanded(existing, desired *appsv1.StatefulSet) bool {
+	if len(desired.Spec.VolumeClaimTemplates) != len(existing.Spec.VolumeClaimTemplates) {
+		return false
+	}
+
+	expanded := false
+	for i := range desired.Spec.VolumeClaimTemplates {
+		existingTemplate := existing.Spec.VolumeClaimTemplates[i]
+		desiredTemplate := desired.Spec.VolumeClaimTemplates[i]
+		if desiredTemplate.Name != existingTemplate.Name ||
+			!apiequality.Semantic.DeepEqual(desiredTemplate.Annotations, existingTemplate.Annotations) {
+			return false
+		}
+
+		existingStorage := existingTemplate.Spec.Resources.Requests[corev1.ResourceStorage]
+		desiredStorage := desiredTemplate.Spec.Resources.Requests[corev1.ResourceStorage]
+		switch desiredStorage.Cmp(existingStorage) {
+		case -1:
+			// volumes cannot be shrinked
+			return false
+		case 1:
+			expanded = true
+		}
+
+		// compare the remaining spec, without the requested storage
+		spec := existingTemplate.Spec.DeepCopy()
+		if spec.Resources.Requests == nil {
+			spec.Resources.Requests = corev1.ResourceList{}
+		}
+		spec.Resources.Requests[corev1.ResourceStorage] = desiredStorage
+		if !apiequality.Semantic.DeepEqual(*spec, desiredTemplate.Spec) {
+			return false
+		}
+	}
+	return expanded
+}
+
+// listStatefulSetClaims returns the PersistentVolumeClaims created from a volumeClaimTemplate of a StatefulSet.
+// The PersistentVolumeClaims of a StatefulSet are named <template>-<statefulset>-<ordinal>.
+func listStatefulSetClaims(ctx context.Context, k8sclient client.Client, sts *appsv1.StatefulSet, template string) ([]corev1.PersistentVolumeClaim, error) {
+	opts := []client.ListOption{client.InNamespace(sts.Namespace)}
+	if sts.Spec.Selector != nil {
+		opts = append(opts, client.MatchingLabels(sts.Spec.Selector.MatchLabels))
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	err := k8sclient.List(ctx, pvcs, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the claims of StatefulSets with a common name prefix (e.g. the ingester StatefulSets of the zones) share the selector labels,
+	// therefore the name must match exactly
+	prefix := fmt.Sprintf("%s-%s-", template, sts.Name)
+	claims := []corev1.PersistentVolumeClaim{}
+	for _, pvc := range pvcs.Items {
+		ordinal, found := strings.CutPrefix(pvc.Name, prefix)
+		if found && isOrdinal(ordinal) {
+			claims = append(claims, pvc)
+		}
+	}
+	return claims, nil
+}
+
+// isOrdinal checks if s is the ordinal of a StatefulSet pod, i.e. a non-negative integer without leading zeros.
+func isOrdinal(s string) bool {
+	ordinal, err := strconv.Atoi(s)
+	return err == nil && ordinal >= 0 && strconv.Itoa(ordinal) == s
+}
+
+// isClaimExpandable checks if the StorageClass of a PersistentVolumeClaim allows volume expansion.
+func isClaimExpandable(ctx context.Context, k8sclient client.Client, pvc corev1.PersistentVolumeClaim) (bool, error) {
+	storageClassName := ptr.Deref(pvc.Spec.StorageClassName, "")
+	if storageClassName == "" {
+		return false, nil
+	}
+
+	storageClass := &storagev1.StorageClass{}
+	err := k8sclient.Get(ctx, types.NamespacedName{Name: storageClassName}, storageClass)
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return ptr.Deref(storageClass.AllowVolumeExpansion, false), nil
+}
+
+// expandStatefulSetVolumes expands the PersistentVolumeClaims of a StatefulSet online, if the only change of the
+// volumeClaimTemplates is an increase of the requested storage and the StorageClass of every claim allows volume expansion.
+// After all claims are updated, the StatefulSet is deleted with orphan propagation and re-created with the new
+// volumeClaimTemplates on the next reconcile. The pods of the StatefulSet are not restarted.
+// Returns false if the volumes cannot be expanded online.
+func expandStatefulSetVolumes(ctx context.Context, k8sclient client.Client, desired *appsv1.StatefulSet) (bool, error) {
+	log := log.FromContext(ctx)
+
+	existing := &appsv1.StatefulSet{}
+	err := k8sclient.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+	if err != nil {
+		return false, err
+	}
+	if !volumeClaimTemplatesExpanded(existing, desired) {
+		return false, nil
+	}
+
+	// verify all claims can be expanded before updating any claim
+	claims := map[string][]corev1.PersistentVolumeClaim{}
+	for _, template := range desired.Spec.VolumeClaimTemplates {
+		pvcs, err := listStatefulSetClaims(ctx, k8sclient, existing, template.Name)
+		if err != nil {
+			return false, err
+		}
+		for _, pvc := range pvcs {
+			expandable, err := isClaimExpandable(ctx, k8sclient, pvc)
+			if err != nil {
+				return false, err
+			}
+			if !expandable {
+				log.Info("storage class does not allow volume expansion", "pvc", pvc.Name)
+				return false, nil
+			}
+		}
+		claims[template.Name] = pvcs
+	}
+
+	for _, template := range desired.Spec.VolumeClaimTemplates {
+		storage := template.Spec.Resources.Requests[corev1.ResourceStorage]
+		for _, pvc := range claims[template.Name] {
+			current := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+			if storage.Cmp(current) <= 0 {
+				continue
+			}
+
+			log.Info("expanding volume", "pvc", pvc.Name, "storage", storage.String())
+			patch := client.MergeFrom(pvc.DeepCopy())
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = storage
+			err := k8sclient.Patch(ctx, &pvc, patch)
+			if err != nil {
+				return false, fmt.Errorf("cannot expand volume %s: %w", pvc.Name, err)
+			}
+		}
+	}
+
+	log.Info("deleting statefulset with orphan propagation to update the volumeClaimTemplates", "statefulset", existing.Name)
+	err = k8sclient.Delete(ctx, existing, client.PropagationPolicy(metav1.DeletePropagationOrphan))
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return true, nil
+}
+
+// getVolumeExpansions returns all bound PersistentVolumeClaims of the StatefulSets,
+// whose capacity is smaller than the requested storage.
+func getVolumeExpansions(ctx context.Context, k8sclient client.Client, manifests []client.Object) ([]v1alpha1.VolumeExpansionStatus, error) {
+	expansions := []v1alpha1.VolumeExpansionStatus{}
+	for _, obj := range manifests {
+		sts, ok := obj.(*appsv1.StatefulSet)
+		if !ok {
+			continue
+		}
+
+		for _, template := range sts.Spec.VolumeClaimTemplates {
+			pvcs, err := listStatefulSetClaims(ctx, k8sclient, sts, template.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, pvc := range pvcs {
+				if pvc.Status.Phase != corev1.ClaimBound {
+					continue
+				}
+
+				requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+				capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+				if capacity.Cmp(requested) < 0 {
+					expansions = append(expansions, v1alpha1.VolumeExpansionStatus{
+						StatefulSet: sts.Name,
+						Claim:       pvc.Name,
+						Requested:   requested,
+						Capacity:    capacity,
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(expansions, func(i, j int) bool {
+		return expansions[i].Claim < expansions[j].Claim
+	})
+	return expansions, nil
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestClaimTemplate(name string, storage string) corev1.PersistentVolumeClaim {
+	return corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(storage)},
+			},
+		},
+	}
+}
+
+func TestVolumeClaimTemplatesExpanded(t *testing.T) {
+	existing := []corev1.PersistentVolumeClaim{newTestClaimTemplate("data", "10Gi")}
+
+	tests := []struct {
+		name     string
+		desired  func() []corev1.PersistentVolumeClaim
+		expanded bool
+	}{
+		{
+			name: "unchanged",
+			desired: func() []corev1.PersistentVolumeClaim {
+				return []corev1.PersistentVolumeClaim{newTestClaimTemplate("data", "10Gi")}
+			},
+			expanded: false,
+		},
+		{
+			name: "same size in a different unit",
+			desired: func() []corev1.PersistentVolumeClaim {
+				return []corev1.PersistentVolumeClaim{newTestClaimTemplate("data", "10240Mi")}
+			},
+			expanded: false,
+		},
+		{
+			name: "storage increased",
+			desired: func() []corev1.PersistentVolumeClaim {
+				return []corev1.PersistentVolumeClaim{newTestClaimTemplate("data", "20Gi")}
+			},
+			expanded: true,
+		},
+		{
+			name: "storage decreased",
+			desired: func() []corev1.PersistentVolumeClaim {
+				return []corev1.PersistentVolumeClaim{newTestClaimTemplate("data", "5Gi")}
+			},
+			expanded: false,
+		},
+		{
+			name: "storage increased and storage class changed",
+			desired: func() []corev1.PersistentVolumeClaim {
+				template := newTestClaimTemplate("data", "20Gi")
+				template.Spec.StorageClassName = ptr.To("fast")
+				return []corev1.PersistentVolumeClaim{template}
+			},
+			expanded: false,
+		},
+		{
+			name: "storage increased and template renamed",
+			desired: func() []corev1.PersistentVolumeClaim {
+				return []corev1.PersistentVolumeClaim{newTestClaimTemplate("storage", "20Gi")}
+			},
+			expanded: false,
+		},
+		{
+			name: "storage increased and annotations changed",
+			desired: func() []corev1.PersistentVolumeClaim {
+				template := newTestClaimTemplate("data", "20Gi")
+				template.Annotations = map[string]string{"backup": "true"}
+				return []corev1.PersistentVolumeClaim{template}
+			},
+			expanded: false,
+		},
+		{
+			name: "template added",
+			desired: func() []corev1.PersistentVolumeClaim {
+				return []corev1.PersistentVolumeClaim{newTestClaimTemplate("data", "20Gi"), newTestClaimTemplate("wal", "1Gi")}
+			},
+			expanded: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			existingSts := &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{VolumeClaimTemplates: existing}}
+			desiredSts := &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{VolumeClaimTemplates: test.desired()}}
+			g.Expect(volumeClaimTemplatesExpanded(existingSts, desiredSts)).To(Equal(test.expanded))
+		})
+	}
+}
+
+func TestListStatefulSetClaims(t *testing.T) {
+	g := NewWithT(t)
+	labels := map[string]string{componentLabel: ingesterComponent}
+	claim := func(name string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels}}
+	}
+	k8sclient := fake.NewClientBuilder().WithObjects(
+		claim("data-tempo-ingester-0"),
+		claim("data-tempo-ingester-1"),
+		claim("data-tempo-ingester-zone-a-0"),
+		claim("data-tempo-ingester-zone-b-0"),
+		claim("wal-tempo-ingester-0"),
+	).Build()
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "tempo-ingester", Namespace: "default"},
+		Spec:       appsv1.StatefulSetSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+	}
+
+	claims, err := listStatefulSetClaims(context.Background(), k8sclient, sts, "data")
+	g.Expect(err).NotTo(HaveOccurred())
+	names := []string{}
+	for _, pvc := range claims {
+		names = append(names, pvc.Name)
+	}
+	// the claims of the zones are not claims of the StatefulSet without a zone, even though their names share the prefix
+	g.Expect(names).To(ConsistOf("data-tempo-ingester-0", "data-tempo-ingester-1"))
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+const (
+	// ownerNameLabel and ownerNamespaceLabel reference the owning TempoMicroservices instance of a cluster-scoped object.
+	// Cluster-scoped objects cannot have an owner reference to a namespaced object.
+	ownerNameLabel      = "tempo.grafana.com/owner-name"
+	ownerNamespaceLabel = "tempo.grafana.com/owner-namespace"
+)
+
+// setOwnerLabels sets labels referencing the owner on a cluster-scoped object.
+func setOwnerLabels(owner metav1.Object, obj client.Object) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[ownerNameLabel] = owner.GetName()
+	labels[ownerNamespaceLabel] = owner.GetNamespace()
+	obj.SetLabels(labels)
+}
+
+// mapOwnerLabels maps a cluster-scoped object to the TempoMicroservices instance referenced by its owner labels.
+func mapOwnerLabels(_ context.Context, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	name, ok := labels[ownerNameLabel]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{
+			Namespace: labels[ownerNamespaceLabel],
+			Name:      name,
+		},
+	}}
+}
+
+// ensureWatches registers a watch for every kind rendered by the helm chart, which is not watched yet.
+// Changes to namespaced objects are mapped to the owner via the controller owner reference,
+// changes to cluster-scoped objects are mapped to the owner via the owner labels.
+// Kinds whose API is not available in the cluster (e.g. OpenShift Routes) are skipped, and checked again on the next reconcile.
+func (r *TempoMicroservicesReconciler) ensureWatches(ctx context.Context, manifests []client.Object) error {
+	if r.controller == nil {
+		// the reconciler was not set up with a manager
+		return nil
+	}
+
+	log := log.FromContext(ctx)
+	r.watchesMu.Lock()
+	defer r.watchesMu.Unlock()
+
+	for _, obj := range manifests {
+		gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+		if err != nil {
+			return err
+		}
+		if r.watches.Has(gvk) {
+			continue
+		}
+
+		err = r.watch(gvk)
+		if meta.IsNoMatchError(err) {
+			log.V(1).Info("API is not available, skipping watch", "kind", gvk)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("cannot watch %s: %w", gvk, err)
+		}
+
+		log.V(1).Info("watching kind", "kind", gvk)
+		r.watches.Insert(gvk)
+	}
+	return nil
+}
+
+func (r *TempoMicroservicesReconciler) watch(gvk schema.GroupVersionKind) error {
+	mapping, err := r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return err
+	}
+
+	// create an empty object of the same type
+	watchObj, err := r.Scheme.New(gvk)
+	if err != nil {
+		return err
+	}
+
+	var eventHandler handler.EventHandler
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		eventHandler = handler.EnqueueRequestForOwner(r.Scheme, r.mapper, &v1alpha1.TempoMicroservices{}, handler.OnlyControllerOwner())
+	} else {
+		eventHandler = handler.EnqueueRequestsFromMapFunc(mapOwnerLabels)
+	}
+
+	return r.controller.Watch(source.Kind(r.cache, watchObj.(client.Object)), eventHandler)
+}
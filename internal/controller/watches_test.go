@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+func TestMapOwnerLabels(t *testing.T) {
+	owner := &v1alpha1.TempoMicroservices{ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "tempo"}}
+
+	tests := []struct {
+		name     string
+		obj      client.Object
+		requests []reconcile.Request
+	}{
+		{
+			name:     "object with owner labels",
+			obj:      &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "tempo"}},
+			requests: []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "tempo", Name: "simplest"}}},
+		},
+		{
+			name:     "object without owner labels",
+			obj:      &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+			requests: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			if test.requests != nil {
+				setOwnerLabels(owner, test.obj)
+			}
+			g.Expect(mapOwnerLabels(context.Background(), test.obj)).To(Equal(test.requests))
+		})
+	}
+}
+
+func TestGetOwnedObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	owner := &v1alpha1.TempoMicroservices{ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "tempo", UID: "owner-uid"}}
+	otherOwner := &v1alpha1.TempoMicroservices{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "tempo", UID: "other-uid"}}
+	controllerRef := func(o *v1alpha1.TempoMicroservices) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{
+			APIVersion: v1alpha1.GroupVersion.String(),
+			Kind:       "TempoMicroservices",
+			Name:       o.Name,
+			UID:        o.UID,
+			Controller: ptr.To(true),
+		}}
+	}
+
+	ownedClusterRole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "owned", UID: "owned-clusterrole"}}
+	setOwnerLabels(owner, ownedClusterRole)
+	otherClusterRole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "other", UID: "other-clusterrole"}}
+	setOwnerLabels(otherOwner, otherClusterRole)
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), meta.RESTScopeNamespace)
+	mapper.Add(rbacv1.SchemeGroupVersion.WithKind("Role"), meta.RESTScopeNamespace)
+	mapper.Add(rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), meta.RESTScopeRoot)
+
+	k8sclient := fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owned", Namespace: "tempo", UID: "owned-cm", OwnerReferences: controllerRef(owner)}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "tempo", UID: "other-cm", OwnerReferences: controllerRef(otherOwner)}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "unowned", Namespace: "tempo", UID: "unowned-cm"}},
+		&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "owned", Namespace: "tempo", UID: "owned-role", OwnerReferences: controllerRef(owner)}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "owned", Namespace: "other-namespace", UID: "other-namespace-dpl", OwnerReferences: controllerRef(owner)}},
+		ownedClusterRole,
+		otherClusterRole,
+	).Build()
+
+	kinds := []schema.GroupVersionKind{
+		corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		appsv1.SchemeGroupVersion.WithKind("Deployment"),
+		rbacv1.SchemeGroupVersion.WithKind("Role"),
+		rbacv1.SchemeGroupVersion.WithKind("ClusterRole"),
+		// the API of this kind is not available
+		schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"},
+	}
+	ownedObjects, err := getOwnedObjects(context.Background(), k8sclient, owner, kinds)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ownedObjects).To(HaveLen(3))
+	g.Expect(ownedObjects).To(HaveKey(types.UID("owned-cm")))
+	g.Expect(ownedObjects).To(HaveKey(types.UID("owned-role")))
+	g.Expect(ownedObjects).To(HaveKey(types.UID("owned-clusterrole")))
+}
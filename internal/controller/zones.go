@@ -0,0 +1,437 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chartutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/status"
+)
+
+const (
+	// configVolumeName is the name of the volume containing the Tempo configuration in the pods rendered by the helm chart.
+	configVolumeName = "config"
+
+	// tempoConfigKey is the key of the Tempo configuration in the ConfigMap or Secret rendered by the helm chart.
+	tempoConfigKey = "tempo.yaml"
+
+	// templateHashAnnotation contains the hash of the pod template of an ingester StatefulSet.
+	// It is used to detect if the pods of a zone will be updated, and if a change restarts the ingesters.
+	templateHashAnnotation = "tempo.grafana.com/template-hash"
+)
+
+// setNestedValue sets a nested value, creating intermediate maps as required.
+func setNestedValue(vals map[string]interface{}, value interface{}, path ...string) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := vals[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			vals[key] = next
+		}
+		vals = next
+	}
+	vals[path[len(path)-1]] = value
+}
+
+// setZoneAwarenessValues enables zone-aware replication in the Tempo configuration.
+// The zone of an ingester is set in a copy of the Tempo configuration per zone, see splitIngesterZones.
+func setZoneAwarenessValues(vals chartutil.Values) {
+	setNestedValue(vals, true, "tempo", "structuredConfig", "ingester", "lifecycler", "ring", "zone_awareness_enabled")
+}
+
+// validateZones checks if the zones are valid DNS labels, because the zone is appended to the name of the ingester StatefulSet.
+func validateZones(zoneAwareness v1alpha1.ZoneAwarenessSpec) error {
+	problems := []string{}
+	for _, zone := range zoneAwareness.Zones {
+		for _, msg := range validation.IsDNS1123Label(zone) {
+			problems = append(problems, fmt.Sprintf("zone %q is invalid: %s", zone, msg))
+		}
+	}
+	if len(problems) > 0 {
+		return &status.ConfigurationError{
+			Reason:  v1alpha1.ReasonInvalidZoneAwareness,
+			Message: strings.Join(problems, "; "),
+		}
+	}
+	return nil
+}
+
+// splitIngesterZones replaces the ingester StatefulSets with one StatefulSet per zone.
+// The pods of each zone mount a copy of the Tempo configuration, in which the availability zone of the ingester is set.
+func splitIngesterZones(manifests []client.Object, zoneAwareness v1alpha1.ZoneAwarenessSpec) ([]client.Object, error) {
+	topologyKey := zoneAwareness.TopologyKey
+	if topologyKey == "" {
+		topologyKey = corev1.LabelTopologyZone
+	}
+
+	objects := []client.Object{}
+	for _, obj := range manifests {
+		sts, ok := obj.(*appsv1.StatefulSet)
+		if !ok || componentOf(sts) != ingesterComponent {
+			objects = append(objects, obj)
+			continue
+		}
+
+		config, err := findConfigObject(manifests, sts)
+		if err != nil {
+			return nil, err
+		}
+
+		// distribute the replicas evenly across the zones
+		zones := int32(len(zoneAwareness.Zones))
+		replicas := (ptr.Deref(sts.Spec.Replicas, 1) + zones - 1) / zones
+		for _, zone := range zoneAwareness.Zones {
+			zoneConfig, err := zoneConfigObject(config, zone)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, zoneConfig, zoneStatefulSet(sts, zone, topologyKey, replicas, zoneConfig.GetName()))
+		}
+	}
+	return objects, nil
+}
+
+// findConfigObject returns the rendered ConfigMap or Secret containing the Tempo configuration of a StatefulSet.
+func findConfigObject(manifests []client.Object, sts *appsv1.StatefulSet) (client.Object, error) {
+	for _, volume := range sts.Spec.Template.Spec.Volumes {
+		if volume.Name != configVolumeName {
+			continue
+		}
+
+		for _, obj := range manifests {
+			switch o := obj.(type) {
+			case *corev1.ConfigMap:
+				if volume.ConfigMap != nil && volume.ConfigMap.Name == o.Name {
+					return o, nil
+				}
+			case *corev1.Secret:
+				if volume.Secret != nil && volume.Secret.SecretName == o.Name {
+					return o, nil
+				}
+			}
+		}
+	}
+	return nil, &status.ConfigurationError{
+		Reason:  v1alpha1.ReasonInvalidZoneAwareness,
+		Message: fmt.Sprintf("zone awareness requires the Tempo configuration of statefulset %s to be rendered by the helm chart, useExternalConfig is not supported", sts.Name),
+	}
+}
+
+// zoneConfigObject returns a copy of a ConfigMap or Secret containing the Tempo configuration, with the availability zone of the ingester set.
+func zoneConfigObject(config client.Object, zone string) (client.Object, error) {
+	zoneConfig := config.DeepCopyObject().(client.Object)
+	zoneConfig.SetName(fmt.Sprintf("%s-%s", config.GetName(), zone))
+
+	switch c := zoneConfig.(type) {
+	case *corev1.ConfigMap:
+		data, err := setAvailabilityZone([]byte(c.Data[tempoConfigKey]), zone)
+		if err != nil {
+			return nil, fmt.Errorf("cannot set the availability zone in configmap %s: %w", config.GetName(), err)
+		}
+		c.Data[tempoConfigKey] = string(data)
+	case *corev1.Secret:
+		data, err := setAvailabilityZone(c.Data[tempoConfigKey], zone)
+		if err != nil {
+			return nil, fmt.Errorf("cannot set the availability zone in secret %s: %w", config.GetName(), err)
+		}
+		c.Data[tempoConfigKey] = data
+	}
+	return zoneConfig, nil
+}
+
+// setAvailabilityZone sets ingester.lifecycler.availability_zone in a Tempo configuration.
+// The configuration is modified as a YAML node tree, to keep all other settings unchanged.
+func setAvailabilityZone(config []byte, zone string) ([]byte, error) {
+	doc := &yaml.Node{}
+	err := yaml.Unmarshal(config, doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+
+	node := doc.Content[0]
+	for _, key := range []string{"ingester", "lifecycler"} {
+		node, err = yamlMappingValue(node, key, &yaml.Node{Kind: yaml.MappingNode})
+		if err != nil {
+			return nil, err
+		}
+	}
+	value, err := yamlMappingValue(node, "availability_zone", &yaml.Node{Kind: yaml.ScalarNode})
+	if err != nil {
+		return nil, err
+	}
+	*value = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: zone}
+
+	return yaml.Marshal(doc)
+}
+
+// yamlMappingValue returns the value of a key of a YAML mapping, and adds the key with the default value if it does not exist.
+func yamlMappingValue(mapping *yaml.Node, key string, defaultValue *yaml.Node) (*yaml.Node, error) {
+	if mapping.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("cannot set %s, the parent is not a mapping", key)
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1], nil
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, defaultValue)
+	return defaultValue, nil
+}
+
+func zoneStatefulSet(sts *appsv1.StatefulSet, zone string, topologyKey string, replicas int32, configName string) *appsv1.StatefulSet {
+	zoneSts := sts.DeepCopy()
+	zoneSts.Name = fmt.Sprintf("%s-%s", sts.Name, zone)
+	zoneSts.Spec.Replicas = ptr.To(replicas)
+
+	zoneSts.Labels = addLabel(zoneSts.Labels, v1alpha1.ZoneLabel, zone)
+	zoneSts.Spec.Template.Labels = addLabel(zoneSts.Spec.Template.Labels, v1alpha1.ZoneLabel, zone)
+	if zoneSts.Spec.Selector == nil {
+		zoneSts.Spec.Selector = &metav1.LabelSelector{}
+	}
+	zoneSts.Spec.Selector.MatchLabels = addLabel(zoneSts.Spec.Selector.MatchLabels, v1alpha1.ZoneLabel, zone)
+
+	podSpec := &zoneSts.Spec.Template.Spec
+	for i := range podSpec.Volumes {
+		volume := &podSpec.Volumes[i]
+		if volume.Name != configVolumeName {
+			continue
+		}
+		if volume.ConfigMap != nil {
+			volume.ConfigMap.Name = configName
+		}
+		if volume.Secret != nil {
+			volume.Secret.SecretName = configName
+		}
+	}
+
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = &corev1.Affinity{}
+	}
+
+	// schedule the pods only on nodes of the zone
+	if podSpec.Affinity.NodeAffinity == nil {
+		podSpec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	nodeAffinity := podSpec.Affinity.NodeAffinity
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	nodeSelector := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(nodeSelector.NodeSelectorTerms) == 0 {
+		nodeSelector.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+	// node selector terms are ORed, therefore the zone requirement is added to every term
+	for i := range nodeSelector.NodeSelectorTerms {
+		nodeSelector.NodeSelectorTerms[i].MatchExpressions = append(nodeSelector.NodeSelectorTerms[i].MatchExpressions, corev1.NodeSelectorRequirement{
+			Key:      topologyKey,
+			Operator: corev1.NodeSelectorOpIn,
+			Values:   []string{zone},
+		})
+	}
+
+	// never schedule the pods in the same zone as the ingesters of other zones
+	if podSpec.Affinity.PodAntiAffinity == nil {
+		podSpec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+	podSpec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+		podSpec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+		corev1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: sts.Spec.Selector.MatchLabels,
+				MatchExpressions: []metav1.LabelSelectorRequirement{{
+					Key:      v1alpha1.ZoneLabel,
+					Operator: metav1.LabelSelectorOpNotIn,
+					Values:   []string{zone},
+				}},
+			},
+			TopologyKey: topologyKey,
+		},
+	)
+	return zoneSts
+}
+
+func addLabel(labels map[string]string, key string, value string) map[string]string {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[key] = value
+	return labels
+}
+
+func setAnnotation(obj metav1.Object, key string, value string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[key] = value
+	obj.SetAnnotations(annotations)
+}
+
+func podTemplateHash(sts *appsv1.StatefulSet) (string, error) {
+	data, err := json.Marshal(sts.Spec.Template)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// annotateTemplateHashes sets the hash of the pod template on all ingester StatefulSets.
+func annotateTemplateHashes(manifests []client.Object) error {
+	for _, sts := range ingesterStatefulSets(manifests) {
+		hash, err := podTemplateHash(sts)
+		if err != nil {
+			return err
+		}
+		setAnnotation(sts, templateHashAnnotation, hash)
+	}
+	return nil
+}
+
+func isZoneRolledOut(sts *appsv1.StatefulSet) bool {
+	return sts.Status.ObservedGeneration >= sts.Generation &&
+		sts.Status.CurrentRevision == sts.Status.UpdateRevision &&
+		sts.Status.ReadyReplicas >= ptr.Deref(sts.Spec.Replicas, 1)
+}
+
+// holdZoneRollouts rolls out the zone-aware ingester StatefulSets one zone at a time.
+// The pods of a zone are updated only after all pods of the previous zones are updated and ready,
+// by setting the partition of the rolling update to the number of replicas.
+// Changes of the pod template are detected by the hash set by annotateTemplateHashes.
+// StatefulSets with the OnDelete update strategy are updated one at a time by the ingesterRollout.
+func holdZoneRollouts(ctx context.Context, k8sclient client.Client, manifests []client.Object) error {
+	log := log.FromContext(ctx)
+
+	hold := false
+	for _, sts := range ingesterStatefulSets(manifests) {
+		if sts.Labels[v1alpha1.ZoneLabel] == "" || sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+			continue
+		}
+
+		if hold {
+			log.V(1).Info("holding rollout of zone until the previous zones are rolled out", "statefulset", sts.Name)
+			sts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+				Type: appsv1.RollingUpdateStatefulSetStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+					Partition: ptr.To(ptr.Deref(sts.Spec.Replicas, 1)),
+				},
+			}
+		}
+
+		existing := &appsv1.StatefulSet{}
+		err := k8sclient.Get(ctx, client.ObjectKeyFromObject(sts), existing)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if existing.Annotations[templateHashAnnotation] != sts.Annotations[templateHashAnnotation] || !isZoneRolledOut(existing) {
+			// the pods of this zone are updated, hold the rollout of all subsequent zones
+			hold = true
+		}
+	}
+	return nil
+}
+
+// retireIngesterStatefulSets scales down the ingester StatefulSets controlled by the owner which are not rendered anymore,
+// e.g. the ingester StatefulSet without a zone after zone awareness was enabled. The StatefulSets are retired regardless
+// of spec.pruning.enabled, because the ingesters of a StatefulSet which is not rendered anymore would keep running with
+// an outdated configuration. Pruning would terminate all ingesters of the StatefulSet at once, without flushing their data.
+// The StatefulSets are added to the manifests with zero replicas, and their ingesters are shut down one at a time by scaleDownIngesters.
+// A StatefulSet is deleted once all its pods are removed. The StatefulSets and their configuration are removed from pruneObjects.
+func retireIngesterStatefulSets(
+	ctx context.Context,
+	k8sclient client.Client,
+	owner metav1.Object,
+	manifests []client.Object,
+	pruneObjects map[types.UID]client.Object,
+) ([]client.Object, error) {
+	log := log.FromContext(ctx)
+
+	rendered := sets.New[string]()
+	for _, sts := range ingesterStatefulSets(manifests) {
+		rendered.Insert(sts.Name)
+	}
+
+	list := &appsv1.StatefulSetList{}
+	err := k8sclient.List(ctx, list, client.InNamespace(owner.GetNamespace()), client.MatchingLabels{componentLabel: ingesterComponent})
+	if err != nil {
+		return nil, err
+	}
+
+	// the ingesters are shut down one at a time, in a stable order
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].Name < list.Items[j].Name
+	})
+
+	for i := range list.Items {
+		sts := &list.Items[i]
+		if !metav1.IsControlledBy(sts, owner) || rendered.Has(sts.Name) {
+			continue
+		}
+		delete(pruneObjects, sts.UID)
+
+		if ptr.Deref(sts.Spec.Replicas, 1) == 0 && sts.Status.Replicas == 0 {
+			log.Info("all ingesters of the statefulset were shut down, deleting statefulset", "statefulset", sts.Name)
+			err = client.IgnoreNotFound(k8sclient.Delete(ctx, sts))
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// the running ingesters keep their configuration until they are shut down
+		configMaps, secrets := podConfigReferences(sts.Spec.Template.Spec)
+		for uid, obj := range pruneObjects {
+			switch obj.GetObjectKind().GroupVersionKind().GroupKind() {
+			case schema.GroupKind{Kind: "ConfigMap"}:
+				if configMaps.Has(obj.GetName()) {
+					delete(pruneObjects, uid)
+				}
+			case schema.GroupKind{Kind: "Secret"}:
+				if secrets.Has(obj.GetName()) {
+					delete(pruneObjects, uid)
+				}
+			}
+		}
+
+		log.V(1).Info("scaling down ingester statefulset which is not rendered anymore", "statefulset", sts.Name)
+		desired := &appsv1.StatefulSet{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: appsv1.SchemeGroupVersion.String(),
+				Kind:       "StatefulSet",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        sts.Name,
+				Namespace:   sts.Namespace,
+				Labels:      sts.Labels,
+				Annotations: sts.Annotations,
+			},
+			Spec: *sts.Spec.DeepCopy(),
+		}
+		desired.Spec.Replicas = ptr.To(int32(0))
+		manifests = append(manifests, desired)
+	}
+	return manifests, nil
+}
@@ -0,0 +1,351 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/status"
+)
+
+func TestValidateZones(t *testing.T) {
+	tests := []struct {
+		name  string
+		zones []string
+		valid bool
+	}{
+		{name: "DNS labels", zones: []string{"us-east-1a", "zone-b"}, valid: true},
+		{name: "uppercase", zones: []string{"Zone-A"}, valid: false},
+		{name: "dot", zones: []string{"us.east"}, valid: false},
+		{name: "trailing dash", zones: []string{"zone-"}, valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := validateZones(v1alpha1.ZoneAwarenessSpec{Enabled: true, Zones: test.zones})
+			if test.valid {
+				g.Expect(err).NotTo(HaveOccurred())
+			} else {
+				var configErr *status.ConfigurationError
+				g.Expect(errors.As(err, &configErr)).To(BeTrue())
+				g.Expect(configErr.Reason).To(Equal(v1alpha1.ReasonInvalidZoneAwareness))
+			}
+		})
+	}
+}
+
+func TestSetAvailabilityZone(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected string
+	}{
+		{
+			name:     "empty configuration",
+			config:   "",
+			expected: "ingester:\n    lifecycler:\n        availability_zone: zone-a\n",
+		},
+		{
+			name:     "other settings are kept",
+			config:   "ingester:\n  max_block_bytes: 1000000\n  lifecycler:\n    ring:\n      replication_factor: 3\nserver:\n  http_listen_port: 3100\n",
+			expected: "ingester:\n    max_block_bytes: 1000000\n    lifecycler:\n        ring:\n            replication_factor: 3\n        availability_zone: zone-a\nserver:\n    http_listen_port: 3100\n",
+		},
+		{
+			name:     "existing zone is replaced",
+			config:   "ingester:\n  lifecycler:\n    availability_zone: ${ZONE}\n",
+			expected: "ingester:\n    lifecycler:\n        availability_zone: zone-a\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			config, err := setAvailabilityZone([]byte(test.config), "zone-a")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(string(config)).To(Equal(test.expected))
+		})
+	}
+}
+
+func newTestZoneManifests() []client.Object {
+	return []client.Object{
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "tempo-config", Namespace: "default"},
+			Data:       map[string]string{tempoConfigKey: "server:\n  http_listen_port: 3100\n"},
+		},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "tempo-querier", Namespace: "default"}},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "tempo-ingester",
+				Namespace: "default",
+				Labels:    map[string]string{componentLabel: ingesterComponent},
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: ptr.To(int32(3)),
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{componentLabel: ingesterComponent}},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{componentLabel: ingesterComponent}},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: ingesterComponent, Args: []string{"-target=ingester"}}},
+						Volumes: []corev1.Volume{{
+							Name:         configVolumeName,
+							VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "tempo-config"}}},
+						}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestSplitIngesterZones(t *testing.T) {
+	g := NewWithT(t)
+
+	manifests, err := splitIngesterZones(newTestZoneManifests(), v1alpha1.ZoneAwarenessSpec{Enabled: true, Zones: []string{"zone-a", "zone-b"}})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	names := []string{}
+	for _, obj := range manifests {
+		names = append(names, obj.GetName())
+	}
+	g.Expect(names).To(Equal([]string{"tempo-config", "tempo-querier", "tempo-config-zone-a", "tempo-ingester-zone-a", "tempo-config-zone-b", "tempo-ingester-zone-b"}))
+
+	for i, zone := range []string{"zone-a", "zone-b"} {
+		config := manifests[2+2*i].(*corev1.ConfigMap)
+		g.Expect(config.Data[tempoConfigKey]).To(ContainSubstring("availability_zone: " + zone))
+
+		sts := manifests[3+2*i].(*appsv1.StatefulSet)
+		// 3 replicas are distributed across 2 zones, rounded up
+		g.Expect(*sts.Spec.Replicas).To(Equal(int32(2)))
+		g.Expect(sts.Labels).To(HaveKeyWithValue(v1alpha1.ZoneLabel, zone))
+		g.Expect(sts.Spec.Selector.MatchLabels).To(HaveKeyWithValue(v1alpha1.ZoneLabel, zone))
+		g.Expect(sts.Spec.Template.Labels).To(HaveKeyWithValue(v1alpha1.ZoneLabel, zone))
+		g.Expect(sts.Spec.Template.Spec.Volumes[0].ConfigMap.Name).To(Equal(config.Name))
+		g.Expect(sts.Spec.Template.Spec.Containers[0].Args).To(Equal([]string{"-target=ingester"}))
+
+		nodeSelector := sts.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		g.Expect(nodeSelector.NodeSelectorTerms[0].MatchExpressions).To(ConsistOf(corev1.NodeSelectorRequirement{
+			Key:      corev1.LabelTopologyZone,
+			Operator: corev1.NodeSelectorOpIn,
+			Values:   []string{zone},
+		}))
+		antiAffinity := sts.Spec.Template.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		g.Expect(antiAffinity).To(HaveLen(1))
+		g.Expect(antiAffinity[0].LabelSelector.MatchExpressions[0].Values).To(Equal([]string{zone}))
+	}
+
+	// the rendered manifests are not modified
+	g.Expect(newTestZoneManifests()[0].(*corev1.ConfigMap).Data[tempoConfigKey]).NotTo(ContainSubstring("availability_zone"))
+}
+
+func TestSplitIngesterZonesExternalConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := splitIngesterZones(newTestZoneManifests()[1:], v1alpha1.ZoneAwarenessSpec{Enabled: true, Zones: []string{"zone-a"}})
+	var configErr *status.ConfigurationError
+	g.Expect(errors.As(err, &configErr)).To(BeTrue())
+	g.Expect(configErr.Reason).To(Equal(v1alpha1.ReasonInvalidZoneAwareness))
+}
+
+func TestHoldZoneRollouts(t *testing.T) {
+	zoneSts := func(zone string, hash string, rolledOut bool) *appsv1.StatefulSet {
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "tempo-ingester-" + zone,
+				Namespace:   "default",
+				Labels:      map[string]string{componentLabel: ingesterComponent, v1alpha1.ZoneLabel: zone},
+				Annotations: map[string]string{templateHashAnnotation: hash},
+			},
+			Spec: appsv1.StatefulSetSpec{Replicas: ptr.To(int32(2))},
+			Status: appsv1.StatefulSetStatus{
+				ReadyReplicas:   2,
+				CurrentRevision: "rev-2",
+				UpdateRevision:  "rev-2",
+			},
+		}
+		if !rolledOut {
+			sts.Status.CurrentRevision = "rev-1"
+		}
+		return sts
+	}
+
+	tests := []struct {
+		name string
+		live []client.Object
+		held []string
+	}{
+		{
+			name: "zones do not exist yet",
+			live: []client.Object{},
+			held: []string{},
+		},
+		{
+			name: "no change",
+			live: []client.Object{zoneSts("a", "v1", true), zoneSts("b", "v1", true), zoneSts("c", "v1", true)},
+			held: []string{},
+		},
+		{
+			name: "pod template changed",
+			live: []client.Object{zoneSts("a", "v0", true), zoneSts("b", "v0", true), zoneSts("c", "v0", true)},
+			held: []string{"tempo-ingester-b", "tempo-ingester-c"},
+		},
+		{
+			name: "second zone is rolling out",
+			live: []client.Object{zoneSts("a", "v1", true), zoneSts("b", "v1", false), zoneSts("c", "v0", true)},
+			held: []string{"tempo-ingester-c"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(test.live...).Build()
+			manifests := []client.Object{zoneSts("a", "v1", false), zoneSts("b", "v1", false), zoneSts("c", "v1", false)}
+
+			g.Expect(holdZoneRollouts(context.Background(), k8sclient, manifests)).To(Succeed())
+
+			held := []string{}
+			for _, sts := range ingesterStatefulSets(manifests) {
+				if sts.Spec.UpdateStrategy.RollingUpdate != nil {
+					g.Expect(sts.Spec.UpdateStrategy.RollingUpdate.Partition).To(Equal(sts.Spec.Replicas))
+					held = append(held, sts.Name)
+				}
+			}
+			g.Expect(held).To(Equal(test.held))
+		})
+	}
+}
+
+func TestRetireIngesterStatefulSets(t *testing.T) {
+	owner := &v1alpha1.TempoMicroservices{ObjectMeta: metav1.ObjectMeta{Name: "simplest", Namespace: "default", UID: "owner-uid"}}
+	unzoned := func(replicas int32, statusReplicas int32) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "tempo-ingester",
+				Namespace:       "default",
+				UID:             "unzoned",
+				Labels:          map[string]string{componentLabel: ingesterComponent},
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(owner, v1alpha1.GroupVersion.WithKind("TempoMicroservices"))},
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: ptr.To(replicas),
+				Template: newTestZoneManifests()[2].(*appsv1.StatefulSet).Spec.Template,
+			},
+			Status: appsv1.StatefulSetStatus{Replicas: statusReplicas},
+		}
+	}
+	owned := func(obj client.Object, kind string) client.Object {
+		u := &unstructured.Unstructured{}
+		if kind == "StatefulSet" {
+			u.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind(kind))
+		} else {
+			u.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind(kind))
+		}
+		u.SetName(obj.GetName())
+		u.SetNamespace(obj.GetNamespace())
+		u.SetUID(obj.GetUID())
+		u.SetLabels(obj.GetLabels())
+		return u
+	}
+	config := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "tempo-config", Namespace: "default", UID: "config"}}
+	otherConfig := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", UID: "other"}}
+
+	notOwned := unzoned(3, 3)
+	notOwned.OwnerReferences = nil
+
+	tests := []struct {
+		name      string
+		live      *appsv1.StatefulSet
+		rendered  bool
+		noPruning bool
+		retired   bool
+		deleted   bool
+		pruneUIDs []types.UID
+	}{
+		{
+			name:      "rendered statefulset",
+			live:      unzoned(3, 3),
+			rendered:  true,
+			pruneUIDs: []types.UID{"config", "other", "unzoned"},
+		},
+		{
+			name:      "statefulset with running ingesters",
+			live:      unzoned(3, 3),
+			retired:   true,
+			pruneUIDs: []types.UID{"other"},
+		},
+		{
+			name:      "statefulset with running ingesters and pruning disabled",
+			live:      unzoned(3, 3),
+			noPruning: true,
+			retired:   true,
+			pruneUIDs: []types.UID{},
+		},
+		{
+			name:      "statefulset which is not controlled by the owner",
+			live:      notOwned,
+			pruneUIDs: []types.UID{"config", "other", "unzoned"},
+		},
+		{
+			name:      "statefulset without ingesters",
+			live:      unzoned(0, 0),
+			deleted:   true,
+			pruneUIDs: []types.UID{"config", "other"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+			k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(test.live, config, otherConfig).Build()
+
+			manifests := []client.Object{}
+			if test.rendered {
+				manifests = append(manifests, test.live.DeepCopy())
+			}
+			pruneObjects := map[types.UID]client.Object{
+				"unzoned": owned(test.live, "StatefulSet"),
+				"config":  owned(config, "ConfigMap"),
+				"other":   owned(otherConfig, "ConfigMap"),
+			}
+			if test.noPruning {
+				pruneObjects = map[types.UID]client.Object{}
+			}
+
+			manifests, err := retireIngesterStatefulSets(ctx, k8sclient, owner, manifests, pruneObjects)
+			g.Expect(err).NotTo(HaveOccurred())
+
+			pruneUIDs := []types.UID{}
+			for uid := range pruneObjects {
+				pruneUIDs = append(pruneUIDs, uid)
+			}
+			g.Expect(pruneUIDs).To(ConsistOf(test.pruneUIDs))
+
+			if test.retired {
+				g.Expect(manifests).To(HaveLen(1))
+				g.Expect(manifests[0].GetName()).To(Equal("tempo-ingester"))
+				g.Expect(*manifests[0].(*appsv1.StatefulSet).Spec.Replicas).To(Equal(int32(0)))
+			} else if !test.rendered {
+				g.Expect(manifests).To(BeEmpty())
+			}
+
+			err = k8sclient.Get(ctx, client.ObjectKeyFromObject(test.live), &appsv1.StatefulSet{})
+			g.Expect(apierrors.IsNotFound(err)).To(Equal(test.deleted))
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package status
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1alpha1 "github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+// workloadHealth describes the availability and rollout progress of a Deployment or StatefulSet.
+// The messages are empty if the workload is available, not progressing or not degraded, respectively.
+type workloadHealth struct {
+	unavailable    string
+	progressing    string
+	degraded       string
+	degradedReason v1alpha1.ConditionReason
+}
+
+func deploymentHealth(dpl *appsv1.Deployment) workloadHealth {
+	health := workloadHealth{}
+	replicas := ptr.Deref(dpl.Spec.Replicas, 1)
+
+	if dpl.Status.AvailableReplicas < replicas {
+		health.unavailable = fmt.Sprintf("deployment %s has %d of %d replicas available", dpl.Name, dpl.Status.AvailableReplicas, replicas)
+	}
+	if dpl.Status.ObservedGeneration < dpl.Generation || dpl.Status.UpdatedReplicas < replicas || dpl.Status.Replicas > dpl.Status.UpdatedReplicas {
+		health.progressing = fmt.Sprintf("deployment %s has %d of %d replicas updated", dpl.Name, dpl.Status.UpdatedReplicas, replicas)
+	}
+
+	for _, c := range dpl.Status.Conditions {
+		switch {
+		case c.Type == appsv1.DeploymentProgressing && c.Status == corev1.ConditionFalse && c.Reason == string(v1alpha1.ReasonProgressDeadlineExceeded):
+			// the rollout is stuck
+			health.progressing = ""
+			health.degraded = fmt.Sprintf("deployment %s: %s", dpl.Name, c.Message)
+			health.degradedReason = v1alpha1.ReasonProgressDeadlineExceeded
+			return health
+		case c.Type == appsv1.DeploymentReplicaFailure && c.Status == corev1.ConditionTrue:
+			health.degraded = fmt.Sprintf("deployment %s: %s", dpl.Name, c.Message)
+			health.degradedReason = v1alpha1.ReasonReplicaFailure
+			return health
+		}
+	}
+
+	if health.unavailable != "" && health.progressing == "" {
+		health.degraded = health.unavailable
+		health.degradedReason = v1alpha1.ReasonReplicasUnavailable
+	}
+	return health
+}
+
+func statefulSetHealth(sts *appsv1.StatefulSet) workloadHealth {
+	health := workloadHealth{}
+	replicas := ptr.Deref(sts.Spec.Replicas, 1)
+
+	if sts.Status.AvailableReplicas < replicas {
+		health.unavailable = fmt.Sprintf("statefulset %s has %d of %d replicas available", sts.Name, sts.Status.AvailableReplicas, replicas)
+	}
+	if sts.Status.ObservedGeneration < sts.Generation || sts.Status.UpdatedReplicas < replicas || sts.Status.CurrentRevision != sts.Status.UpdateRevision {
+		health.progressing = fmt.Sprintf("statefulset %s has %d of %d replicas updated", sts.Name, sts.Status.UpdatedReplicas, replicas)
+	}
+
+	// StatefulSets have no progress deadline, therefore an unavailable StatefulSet is degraded only if no rollout is in progress
+	if health.unavailable != "" && health.progressing == "" {
+		health.degraded = health.unavailable
+		health.degradedReason = v1alpha1.ReasonReplicasUnavailable
+	}
+	return health
+}
+
+func workloadHealthOf(workload client.Object) workloadHealth {
+	switch workload := workload.(type) {
+	case *appsv1.Deployment:
+		return deploymentHealth(workload)
+	case *appsv1.StatefulSet:
+		return statefulSetHealth(workload)
+	default:
+		return workloadHealth{}
+	}
+}
+
+// componentConditions computes the Available, Progressing and Degraded conditions of a component from the status of its workloads.
+// The existing conditions of the component are updated, to keep the last transition time of unchanged conditions.
+func componentConditions(existing []metav1.Condition, workloads []client.Object) []metav1.Condition {
+	var unavailable, progressing, degraded []string
+	degradedReason := v1alpha1.ReasonAsExpected
+	for _, workload := range workloads {
+		health := workloadHealthOf(workload)
+		if health.unavailable != "" {
+			unavailable = append(unavailable, health.unavailable)
+		}
+		if health.progressing != "" {
+			progressing = append(progressing, health.progressing)
+		}
+		if health.degraded != "" {
+			if len(degraded) == 0 {
+				degradedReason = health.degradedReason
+			}
+			degraded = append(degraded, health.degraded)
+		}
+	}
+
+	conditions := []metav1.Condition{}
+	for _, c := range existing {
+		conditions = append(conditions, *c.DeepCopy())
+	}
+
+	available := metav1.Condition{
+		Type:    string(v1alpha1.ConditionAvailable),
+		Status:  conditionStatus(len(unavailable) == 0),
+		Reason:  string(v1alpha1.ReasonReplicasAvailable),
+		Message: "All replicas are available",
+	}
+	if len(unavailable) > 0 {
+		available.Reason = string(v1alpha1.ReasonReplicasUnavailable)
+		available.Message = strings.Join(unavailable, "; ")
+	}
+
+	rollout := metav1.Condition{
+		Type:    string(v1alpha1.ConditionProgressing),
+		Status:  conditionStatus(len(progressing) > 0),
+		Reason:  string(v1alpha1.ReasonRolloutComplete),
+		Message: "All replicas are updated",
+	}
+	if len(progressing) > 0 {
+		rollout.Reason = string(v1alpha1.ReasonRollingOut)
+		rollout.Message = strings.Join(progressing, "; ")
+	} else if degradedReason == v1alpha1.ReasonProgressDeadlineExceeded {
+		rollout.Reason = string(v1alpha1.ReasonProgressDeadlineExceeded)
+		rollout.Message = strings.Join(degraded, "; ")
+	}
+
+	degradedCondition := metav1.Condition{
+		Type:    string(v1alpha1.ConditionDegraded),
+		Status:  conditionStatus(len(degraded) > 0),
+		Reason:  string(degradedReason),
+		Message: strings.Join(degraded, "; "),
+	}
+
+	meta.SetStatusCondition(&conditions, available)
+	meta.SetStatusCondition(&conditions, rollout)
+	meta.SetStatusCondition(&conditions, degradedCondition)
+	return conditions
+}
+
+// getSummary counts the ready and desired replicas of the workloads of the main Tempo components.
+func getSummary(workloads []client.Object) v1alpha1.StatusSummary {
+	ready := map[string]int32{}
+	desired := map[string]int32{}
+	for _, workload := range workloads {
+		component := workload.GetLabels()[componentLabel]
+		switch workload := workload.(type) {
+		case *appsv1.Deployment:
+			ready[component] += workload.Status.ReadyReplicas
+			desired[component] += ptr.Deref(workload.Spec.Replicas, 1)
+		case *appsv1.StatefulSet:
+			ready[component] += workload.Status.ReadyReplicas
+			desired[component] += ptr.Deref(workload.Spec.Replicas, 1)
+		}
+	}
+
+	replicas := func(component string) string {
+		if _, ok := desired[component]; !ok {
+			return ""
+		}
+		return fmt.Sprintf("%d/%d", ready[component], desired[component])
+	}
+	return v1alpha1.StatusSummary{
+		Distributors:      replicas("distributor"),
+		Ingesters:         replicas("ingester"),
+		Queriers:          replicas("querier"),
+		QueryFrontends:    replicas("query-frontend"),
+		Compactors:        replicas("compactor"),
+		MetricsGenerators: replicas("metrics-generator"),
+	}
+}
@@ -0,0 +1,198 @@
+package status
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1alpha1 "github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+func newTestDeployment(replicas int32, available int32, updated int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "tempo-distributor", Generation: 1},
+		Spec:       appsv1.DeploymentSpec{Replicas: ptr.To(replicas)},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 1,
+			Replicas:           replicas,
+			AvailableReplicas:  available,
+			UpdatedReplicas:    updated,
+		},
+	}
+}
+
+func newTestIngester(replicas int32, available int32, updated int32, updateRevision string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "tempo-ingester", Generation: 1},
+		Spec:       appsv1.StatefulSetSpec{Replicas: ptr.To(replicas)},
+		Status: appsv1.StatefulSetStatus{
+			ObservedGeneration: 1,
+			AvailableReplicas:  available,
+			UpdatedReplicas:    updated,
+			CurrentRevision:    "rev-1",
+			UpdateRevision:     updateRevision,
+		},
+	}
+}
+
+var _ = Describe("Deployment health", func() {
+	It("is healthy if all replicas are available and updated", func() {
+		Expect(deploymentHealth(newTestDeployment(2, 2, 2))).To(Equal(workloadHealth{}))
+	})
+
+	It("is progressing during a rollout", func() {
+		health := deploymentHealth(newTestDeployment(2, 1, 1))
+		Expect(health.unavailable).To(Equal("deployment tempo-distributor has 1 of 2 replicas available"))
+		Expect(health.progressing).To(Equal("deployment tempo-distributor has 1 of 2 replicas updated"))
+		Expect(health.degraded).To(BeEmpty())
+	})
+
+	It("is progressing if the generation was not observed yet", func() {
+		dpl := newTestDeployment(2, 2, 2)
+		dpl.Generation = 2
+		Expect(deploymentHealth(dpl).progressing).NotTo(BeEmpty())
+	})
+
+	It("is degraded if replicas are unavailable without a rollout", func() {
+		health := deploymentHealth(newTestDeployment(2, 1, 2))
+		Expect(health.progressing).To(BeEmpty())
+		Expect(health.degraded).To(Equal(health.unavailable))
+		Expect(health.degradedReason).To(Equal(v1alpha1.ReasonReplicasUnavailable))
+	})
+
+	It("is degraded if the progress deadline is exceeded", func() {
+		dpl := newTestDeployment(2, 1, 1)
+		dpl.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:    appsv1.DeploymentProgressing,
+			Status:  corev1.ConditionFalse,
+			Reason:  string(v1alpha1.ReasonProgressDeadlineExceeded),
+			Message: "ReplicaSet has timed out progressing.",
+		}}
+		health := deploymentHealth(dpl)
+		Expect(health.progressing).To(BeEmpty())
+		Expect(health.degraded).To(Equal("deployment tempo-distributor: ReplicaSet has timed out progressing."))
+		Expect(health.degradedReason).To(Equal(v1alpha1.ReasonProgressDeadlineExceeded))
+	})
+
+	It("is degraded if replicas cannot be created", func() {
+		dpl := newTestDeployment(2, 1, 2)
+		dpl.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:    appsv1.DeploymentReplicaFailure,
+			Status:  corev1.ConditionTrue,
+			Message: "exceeded quota",
+		}}
+		health := deploymentHealth(dpl)
+		Expect(health.degraded).To(Equal("deployment tempo-distributor: exceeded quota"))
+		Expect(health.degradedReason).To(Equal(v1alpha1.ReasonReplicaFailure))
+	})
+})
+
+var _ = Describe("StatefulSet health", func() {
+	It("is healthy if all replicas are available and updated", func() {
+		Expect(statefulSetHealth(newTestIngester(2, 2, 2, "rev-1"))).To(Equal(workloadHealth{}))
+	})
+
+	It("is progressing until the update revision is the current revision", func() {
+		health := statefulSetHealth(newTestIngester(2, 1, 2, "rev-2"))
+		Expect(health.progressing).To(Equal("statefulset tempo-ingester has 2 of 2 replicas updated"))
+		Expect(health.degraded).To(BeEmpty())
+	})
+
+	It("is degraded if replicas are unavailable without a rollout", func() {
+		health := statefulSetHealth(newTestIngester(2, 1, 2, "rev-1"))
+		Expect(health.unavailable).To(Equal("statefulset tempo-ingester has 1 of 2 replicas available"))
+		Expect(health.degraded).To(Equal(health.unavailable))
+		Expect(health.degradedReason).To(Equal(v1alpha1.ReasonReplicasUnavailable))
+	})
+})
+
+var _ = Describe("Component conditions", func() {
+	findCondition := func(conditions []metav1.Condition, conditionType v1alpha1.ConditionStatus) *metav1.Condition {
+		condition := meta.FindStatusCondition(conditions, string(conditionType))
+		Expect(condition).NotTo(BeNil())
+		return condition
+	}
+
+	It("is available if all workloads are healthy", func() {
+		conditions := componentConditions(nil, []client.Object{newTestDeployment(2, 2, 2), newTestIngester(2, 2, 2, "rev-1")})
+
+		Expect(conditions).To(HaveLen(3))
+		Expect(findCondition(conditions, v1alpha1.ConditionAvailable).Status).To(Equal(metav1.ConditionTrue))
+		Expect(findCondition(conditions, v1alpha1.ConditionProgressing).Status).To(Equal(metav1.ConditionFalse))
+		Expect(findCondition(conditions, v1alpha1.ConditionDegraded).Status).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("lists the messages of all workloads", func() {
+		conditions := componentConditions(nil, []client.Object{newTestDeployment(2, 1, 1), newTestIngester(2, 1, 2, "rev-2")})
+
+		available := findCondition(conditions, v1alpha1.ConditionAvailable)
+		Expect(available.Status).To(Equal(metav1.ConditionFalse))
+		Expect(available.Reason).To(Equal(string(v1alpha1.ReasonReplicasUnavailable)))
+		Expect(available.Message).To(Equal("deployment tempo-distributor has 1 of 2 replicas available; statefulset tempo-ingester has 1 of 2 replicas available"))
+
+		progressing := findCondition(conditions, v1alpha1.ConditionProgressing)
+		Expect(progressing.Status).To(Equal(metav1.ConditionTrue))
+		Expect(progressing.Reason).To(Equal(string(v1alpha1.ReasonRollingOut)))
+		Expect(findCondition(conditions, v1alpha1.ConditionDegraded).Status).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("reports an exceeded progress deadline as not progressing and degraded", func() {
+		dpl := newTestDeployment(2, 1, 1)
+		dpl.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:    appsv1.DeploymentProgressing,
+			Status:  corev1.ConditionFalse,
+			Reason:  string(v1alpha1.ReasonProgressDeadlineExceeded),
+			Message: "ReplicaSet has timed out progressing.",
+		}}
+		conditions := componentConditions(nil, []client.Object{dpl})
+
+		progressing := findCondition(conditions, v1alpha1.ConditionProgressing)
+		Expect(progressing.Status).To(Equal(metav1.ConditionFalse))
+		Expect(progressing.Reason).To(Equal(string(v1alpha1.ReasonProgressDeadlineExceeded)))
+
+		degraded := findCondition(conditions, v1alpha1.ConditionDegraded)
+		Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+		Expect(degraded.Reason).To(Equal(string(v1alpha1.ReasonProgressDeadlineExceeded)))
+		Expect(degraded.Message).To(Equal("deployment tempo-distributor: ReplicaSet has timed out progressing."))
+	})
+
+	It("keeps the last transition time of unchanged conditions", func() {
+		transition := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+		existing := componentConditions(nil, []client.Object{newTestDeployment(2, 2, 2)})
+		for i := range existing {
+			existing[i].LastTransitionTime = transition
+		}
+
+		conditions := componentConditions(existing, []client.Object{newTestDeployment(2, 1, 2)})
+		Expect(findCondition(conditions, v1alpha1.ConditionAvailable).LastTransitionTime).NotTo(Equal(transition))
+		Expect(findCondition(conditions, v1alpha1.ConditionProgressing).LastTransitionTime).To(Equal(transition))
+		Expect(findCondition(existing, v1alpha1.ConditionAvailable).Status).To(Equal(metav1.ConditionTrue))
+	})
+})
+
+var _ = Describe("Summary", func() {
+	It("counts the ready and desired replicas of each component", func() {
+		distributor := newTestDeployment(2, 2, 2)
+		distributor.Labels = map[string]string{componentLabel: "distributor"}
+		distributor.Status.ReadyReplicas = 1
+		zoneA := newTestIngester(2, 2, 2, "rev-1")
+		zoneA.Labels = map[string]string{componentLabel: "ingester"}
+		zoneA.Status.ReadyReplicas = 2
+		zoneB := newTestIngester(1, 0, 0, "rev-1")
+		zoneB.Labels = map[string]string{componentLabel: "ingester"}
+		gateway := newTestDeployment(1, 1, 1)
+		gateway.Labels = map[string]string{componentLabel: "gateway"}
+
+		Expect(getSummary([]client.Object{distributor, zoneA, zoneB, gateway})).To(Equal(v1alpha1.StatusSummary{
+			Distributors: "1/2",
+			Ingesters:    "2/3",
+		}))
+	})
+})
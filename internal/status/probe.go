@@ -0,0 +1,97 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1alpha1 "github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/tempoapi"
+)
+
+// ServingProbe probes the HTTP endpoints of the Tempo components through the Services of the components.
+type ServingProbe struct {
+	QueryFrontend    *tempoapi.Client
+	QueryFrontendURL string
+	Distributor      *tempoapi.Client
+	DistributorURL   string
+}
+
+// probeTimeout is the timeout of all probes, to not block the reconciliation if a component does not respond.
+const probeTimeout = 5 * time.Second
+
+// probe runs all probes concurrently, and returns the reason and messages of the failed probes.
+func (p *ServingProbe) probe(ctx context.Context) (v1alpha1.ConditionReason, []string) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	var ring *tempoapi.Ring
+	probes := []struct {
+		failure string
+		probe   func() error
+	}{
+		{"query-frontend is not ready", func() error { return p.QueryFrontend.Ready(ctx, p.QueryFrontendURL) }},
+		{"query-frontend does not serve API requests", func() error { return p.QueryFrontend.Echo(ctx, p.QueryFrontendURL) }},
+		{"distributor is not ready", func() error { return p.Distributor.Ready(ctx, p.DistributorURL) }},
+		{"cannot read ingester ring", func() (err error) {
+			ring, err = p.Distributor.IngesterRing(ctx, p.DistributorURL)
+			return err
+		}},
+	}
+
+	errs := make([]error, len(probes))
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		wg.Add(1)
+		go func(i int, probe func() error) {
+			defer wg.Done()
+			errs[i] = probe()
+		}(i, probe.probe)
+	}
+	wg.Wait()
+
+	failures := []string{}
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", probes[i].failure, err))
+		}
+	}
+	if len(failures) > 0 {
+		return v1alpha1.ReasonProbeFailed, failures
+	}
+
+	if failures := ringFailures(ring); len(failures) > 0 {
+		return v1alpha1.ReasonRingUnhealthy, failures
+	}
+	return v1alpha1.ReasonProbesSucceeded, nil
+}
+
+// setServingCondition probes the Tempo components, and sets the Serving condition.
+// The Serving condition is removed if probing is disabled, and kept unchanged if the probe could not be created,
+// e.g. because the reconciliation failed before the manifests were rendered.
+func setServingCondition(ctx context.Context, conditions *[]metav1.Condition, tempo v1alpha1.TempoMicroservices, probe *ServingProbe) {
+	if !tempo.Spec.HealthProbes.Enabled {
+		meta.RemoveStatusCondition(conditions, string(v1alpha1.ConditionServing))
+		return
+	}
+	if probe == nil {
+		return
+	}
+
+	reason, failures := probe.probe(ctx)
+	condition := metav1.Condition{
+		Type:    string(v1alpha1.ConditionServing),
+		Reason:  string(reason),
+		Message: "All probes succeeded",
+		Status:  conditionStatus(len(failures) == 0),
+	}
+	if len(failures) > 0 {
+		condition.Message = strings.Join(failures, "; ")
+	}
+	meta.SetStatusCondition(conditions, condition)
+}
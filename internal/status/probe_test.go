@@ -0,0 +1,135 @@
+package status
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1alpha1 "github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/tempoapi"
+)
+
+var _ = Describe("Serving condition", func() {
+	ctx := context.Background()
+	tempo := v1alpha1.TempoMicroservices{
+		Spec: v1alpha1.TempoMicroservicesSpec{
+			HealthProbes: v1alpha1.HealthProbesSpec{Enabled: true},
+		},
+	}
+
+	var queryFrontend, distributor *httptest.Server
+	var queryFrontendReady, hang bool
+	var ring string
+
+	// hangs until the probe gives up, if the component does not respond
+	respond := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if hang {
+				<-r.Context().Done()
+				return
+			}
+			handler(w, r)
+		}
+	}
+
+	BeforeEach(func() {
+		queryFrontendReady = true
+		hang = false
+		ring = `{"shards":[{"id":"tempo-ingester-0","state":"ACTIVE"},{"id":"tempo-ingester-1","state":"JOINING"}]}`
+
+		queryFrontendMux := http.NewServeMux()
+		queryFrontendMux.HandleFunc("/ready", respond(func(w http.ResponseWriter, r *http.Request) {
+			if !queryFrontendReady {
+				http.Error(w, "not ready", http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte("ready"))
+		}))
+		queryFrontendMux.HandleFunc("/api/echo", respond(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("echo"))
+		}))
+		queryFrontend = httptest.NewServer(queryFrontendMux)
+
+		distributorMux := http.NewServeMux()
+		distributorMux.HandleFunc("/ready", respond(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ready"))
+		}))
+		distributorMux.HandleFunc("/ingester/ring", respond(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(ring))
+		}))
+		distributor = httptest.NewServer(distributorMux)
+	})
+
+	AfterEach(func() {
+		queryFrontend.Close()
+		distributor.Close()
+	})
+
+	probe := func() *ServingProbe {
+		return &ServingProbe{
+			QueryFrontend:    tempoapi.NewClient(nil),
+			QueryFrontendURL: queryFrontend.URL,
+			Distributor:      tempoapi.NewClient(nil),
+			DistributorURL:   distributor.URL,
+		}
+	}
+
+	It("is true if all probes succeed", func() {
+		conditions := []metav1.Condition{}
+		setServingCondition(ctx, &conditions, tempo, probe())
+
+		condition := meta.FindStatusCondition(conditions, string(v1alpha1.ConditionServing))
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(string(v1alpha1.ReasonProbesSucceeded)))
+	})
+
+	It("is false if an endpoint is not ready", func() {
+		queryFrontendReady = false
+		conditions := []metav1.Condition{}
+		setServingCondition(ctx, &conditions, tempo, probe())
+
+		condition := meta.FindStatusCondition(conditions, string(v1alpha1.ConditionServing))
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(string(v1alpha1.ReasonProbeFailed)))
+		Expect(condition.Message).To(ContainSubstring("query-frontend is not ready"))
+	})
+
+	It("is false if the ring is unhealthy", func() {
+		ring = `{"shards":[{"id":"tempo-ingester-0","state":"ACTIVE"},{"id":"tempo-ingester-1","state":"UNHEALTHY"}]}`
+		conditions := []metav1.Condition{}
+		setServingCondition(ctx, &conditions, tempo, probe())
+
+		condition := meta.FindStatusCondition(conditions, string(v1alpha1.ConditionServing))
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(string(v1alpha1.ReasonRingUnhealthy)))
+		Expect(condition.Message).To(Equal("ingester tempo-ingester-1 is unhealthy"))
+	})
+
+	It("is false if the components do not respond within the probe timeout", func() {
+		hang = true
+		conditions := []metav1.Condition{}
+		start := time.Now()
+		setServingCondition(ctx, &conditions, tempo, probe())
+
+		// the probes share a single deadline
+		Expect(time.Since(start)).To(BeNumerically("<", 2*probeTimeout))
+		condition := meta.FindStatusCondition(conditions, string(v1alpha1.ConditionServing))
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(string(v1alpha1.ReasonProbeFailed)))
+		Expect(strings.Split(condition.Message, "; ")).To(HaveLen(4))
+	})
+
+	It("is removed if probing is disabled", func() {
+		conditions := []metav1.Condition{{Type: string(v1alpha1.ConditionServing), Status: metav1.ConditionTrue}}
+		setServingCondition(ctx, &conditions, v1alpha1.TempoMicroservices{}, nil)
+		Expect(conditions).To(BeEmpty())
+	})
+})
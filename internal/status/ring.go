@@ -0,0 +1,83 @@
+package status
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1alpha1 "github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/tempoapi"
+)
+
+// heartbeatPrecision is the precision of the last heartbeat of the ring members in the status.
+const heartbeatPrecision = time.Minute
+
+// ringFailures checks if at least one ingester is active in the ring, and no ingester is unhealthy.
+// Returns a message for every problem found.
+func ringFailures(ring *tempoapi.Ring) []string {
+	failures := []string{}
+	active := 0
+	for _, instance := range ring.Instances {
+		switch instance.State {
+		case tempoapi.InstanceStateActive:
+			active++
+		case tempoapi.InstanceStateUnhealthy:
+			failures = append(failures, fmt.Sprintf("ingester %s is unhealthy", instance.ID))
+		}
+	}
+	if active == 0 {
+		failures = append(failures, "no ingester is active in the ring")
+	}
+	return failures
+}
+
+// SetRingStatus sets the members of the ingester ring and the RingHealthy condition.
+// If the ring could not be read, the condition is set to unknown and the previous members are kept.
+// If ring and err are nil, i.e. no ingester is deployed, the members and the condition are removed.
+func SetRingStatus(status *v1alpha1.TempoMicroservicesStatus, ring *tempoapi.Ring, err error) {
+	if err != nil {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    string(v1alpha1.ConditionRingHealthy),
+			Reason:  string(v1alpha1.ReasonRingUnavailable),
+			Message: err.Error(),
+			Status:  metav1.ConditionUnknown,
+		})
+		return
+	}
+	if ring == nil {
+		status.Ring = nil
+		meta.RemoveStatusCondition(&status.Conditions, string(v1alpha1.ConditionRingHealthy))
+		return
+	}
+
+	status.Ring = []v1alpha1.RingMember{}
+	for _, instance := range ring.Instances {
+		member := v1alpha1.RingMember{
+			ID:     instance.ID,
+			State:  instance.State,
+			Zone:   instance.Zone,
+			Tokens: int32(len(instance.Tokens)),
+		}
+		// the heartbeat is truncated, to not update the status on every heartbeat of the ingesters
+		if heartbeat, err := instance.LastHeartbeat(); err == nil {
+			member.LastHeartbeat = &metav1.Time{Time: heartbeat.Truncate(heartbeatPrecision)}
+		}
+		status.Ring = append(status.Ring, member)
+	}
+
+	condition := metav1.Condition{
+		Type:    string(v1alpha1.ConditionRingHealthy),
+		Reason:  string(v1alpha1.ReasonRingHealthy),
+		Message: fmt.Sprintf("%d ingesters in the ring", len(ring.Instances)),
+		Status:  metav1.ConditionTrue,
+	}
+	if failures := ringFailures(ring); len(failures) > 0 {
+		condition.Reason = string(v1alpha1.ReasonRingUnhealthy)
+		condition.Message = strings.Join(failures, "; ")
+		condition.Status = metav1.ConditionFalse
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+}
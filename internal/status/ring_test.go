@@ -0,0 +1,51 @@
+package status
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1alpha1 "github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/tempoapi"
+)
+
+var _ = Describe("Ring status", func() {
+	ring := func(timestamp string) *tempoapi.Ring {
+		return &tempoapi.Ring{Instances: []tempoapi.RingInstance{{
+			ID:        "tempo-ingester-0",
+			State:     tempoapi.InstanceStateActive,
+			Timestamp: timestamp,
+			Tokens:    []uint32{1, 2},
+		}}}
+	}
+
+	It("does not change on every heartbeat", func() {
+		first := &v1alpha1.TempoMicroservicesStatus{}
+		SetRingStatus(first, ring("2024-01-01 12:00:05.123456789 +0000 UTC"), nil)
+		second := first.DeepCopy()
+		SetRingStatus(second, ring("2024-01-01 12:00:10.987654321 +0000 UTC"), nil)
+
+		Expect(first.Ring).To(Equal([]v1alpha1.RingMember{{
+			ID:            "tempo-ingester-0",
+			State:         tempoapi.InstanceStateActive,
+			Tokens:        2,
+			LastHeartbeat: &metav1.Time{Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)},
+		}}))
+		Expect(second).To(Equal(first))
+	})
+
+	It("keeps the members if the ring cannot be read", func() {
+		status := &v1alpha1.TempoMicroservicesStatus{}
+		SetRingStatus(status, ring("2024-01-01 12:00:05 +0000 UTC"), nil)
+		SetRingStatus(status, nil, errors.New("connection refused"))
+
+		Expect(status.Ring).To(HaveLen(1))
+		condition := meta.FindStatusCondition(status.Conditions, string(v1alpha1.ConditionRingHealthy))
+		Expect(condition.Status).To(Equal(metav1.ConditionUnknown))
+		Expect(condition.Reason).To(Equal(string(v1alpha1.ReasonRingUnavailable)))
+	})
+})
@@ -4,18 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	v1alpha1 "github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
-	"github.com/andreasgerstmayr/tempo-helm-operator/internal/manifestutils"
 )
 
 const (
@@ -25,9 +30,12 @@ const (
 )
 
 // ConfigurationError contains information about why the managed TempoStack has an invalid configuration.
+// Configuration errors are terminal, unless Retry is set.
 type ConfigurationError struct {
 	Reason  v1alpha1.ConditionReason
 	Message string
+	// Retry defines if the reconciliation is retried, e.g. if the configuration references a Secret which may be created later.
+	Retry bool
 }
 
 func (e *ConfigurationError) Error() string {
@@ -43,22 +51,89 @@ func isPodReady(pod corev1.Pod) bool {
 	return true
 }
 
-func getPodsStatus(ctx context.Context, c client.Client, namespace string, name string, component string) (v1alpha1.PodStatusMap, error) {
+// podFailure describes why a pod is considered failed, although its phase is not Failed.
+type podFailure struct {
+	reason  v1alpha1.ConditionReason
+	message string
+}
+
+// oomKilledInterval is the time after the termination of a container which ran out of memory, in which the pod is considered failed.
+// Containers in a crash loop are considered failed regardless of the time of their last termination.
+const oomKilledInterval = 5 * time.Minute
+
+// getPodFailure checks the containers of a pod for image pull errors, crash loops and containers recently terminated
+// because they ran out of memory. Returns nil if no container failed.
+func getPodFailure(pod corev1.Pod, now time.Time) *podFailure {
+	containerStatuses := append(slices.Clone(pod.Status.InitContainerStatuses), pod.Status.ContainerStatuses...)
+	for _, c := range containerStatuses {
+		if c.Ready {
+			continue
+		}
+
+		var waitingReason, waitingMessage string
+		if c.State.Waiting != nil {
+			waitingReason = c.State.Waiting.Reason
+			waitingMessage = c.State.Waiting.Message
+		}
+
+		lastTermination := ""
+		oomKilled := false
+		if terminated := c.LastTerminationState.Terminated; terminated != nil {
+			oomKilled = terminated.Reason == "OOMKilled" &&
+				(waitingReason == "CrashLoopBackOff" || now.Sub(terminated.FinishedAt.Time) < oomKilledInterval)
+			lastTermination = fmt.Sprintf(", last termination: %s (exit code %d)", terminated.Reason, terminated.ExitCode)
+			if terminated.Message != "" {
+				lastTermination = fmt.Sprintf("%s: %s", lastTermination, terminated.Message)
+			}
+		}
+
+		switch {
+		case waitingReason == "ErrImagePull" || waitingReason == "ImagePullBackOff" || waitingReason == "InvalidImageName":
+			return &podFailure{
+				reason:  v1alpha1.ReasonImagePullFailed,
+				message: fmt.Sprintf("pod %s container %s: %s: %s", pod.Name, c.Name, waitingReason, waitingMessage),
+			}
+		case oomKilled:
+			return &podFailure{
+				reason:  v1alpha1.ReasonOOMKilled,
+				message: fmt.Sprintf("pod %s container %s restarted %d times%s", pod.Name, c.Name, c.RestartCount, lastTermination),
+			}
+		case waitingReason == "CrashLoopBackOff":
+			return &podFailure{
+				reason:  v1alpha1.ReasonCrashLooping,
+				message: fmt.Sprintf("pod %s container %s restarted %d times%s", pod.Name, c.Name, c.RestartCount, lastTermination),
+			}
+		}
+	}
+	return nil
+}
+
+// componentLabel is set by the helm chart on all workloads and pods, and contains the name of the component.
+const componentLabel = "app.kubernetes.io/component"
+
+// listPodsStatus returns the pod status of the pods matching the selector.
+// Pods with failed containers are considered failed, see getPodFailure.
+func listPodsStatus(ctx context.Context, c client.Client, namespace string, selector labels.Selector) (v1alpha1.PodStatusMap, []podFailure, error) {
 	psm := v1alpha1.PodStatusMap{}
 	opts := []client.ListOption{
-		client.MatchingLabels(manifestutils.ComponentLabels(component, name)),
+		client.MatchingLabelsSelector{Selector: selector},
 		client.InNamespace(namespace),
 	}
 
 	pods := &corev1.PodList{}
 	err := c.List(ctx, pods, opts...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	now := time.Now()
+	failures := []podFailure{}
 	for _, pod := range pods.Items {
 		phase := pod.Status.Phase
-		if phase == corev1.PodRunning {
+		if failure := getPodFailure(pod, now); failure != nil && (phase == corev1.PodPending || phase == corev1.PodRunning) {
+			phase = corev1.PodFailed
+			failures = append(failures, *failure)
+		} else if phase == corev1.PodRunning {
 			// for the component status consider running, but not ready, pods as pending
 			if !isPodReady(pod) {
 				phase = corev1.PodPending
@@ -67,73 +142,129 @@ func getPodsStatus(ctx context.Context, c client.Client, namespace string, name
 		psm[phase] = append(psm[phase], pod.Name)
 	}
 
-	return psm, nil
+	return psm, failures, nil
 }
 
-func getStatefulSetStatus(ctx context.Context, c client.Client, namespace string, name string, component string) (v1alpha1.PodStatusMap, error) {
-	psm := v1alpha1.PodStatusMap{}
+// listWorkloads returns all Deployments and StatefulSets controlled by the TempoMicroservices instance.
+func listWorkloads(ctx context.Context, c client.Client, tempo v1alpha1.TempoMicroservices) ([]client.Object, error) {
+	workloads := []client.Object{}
 
-	opts := []client.ListOption{
-		client.MatchingLabels(manifestutils.ComponentLabels(component, name)),
-		client.InNamespace(namespace),
+	deployments := &appsv1.DeploymentList{}
+	err := c.List(ctx, deployments, client.InNamespace(tempo.Namespace))
+	if err != nil {
+		return nil, err
+	}
+	for i := range deployments.Items {
+		if metav1.IsControlledBy(&deployments.Items[i], &tempo) {
+			workloads = append(workloads, &deployments.Items[i])
+		}
 	}
 
-	// After creation of a StatefulSet, but before the Pods are created, the list of Pods is empty
-	// and therefore no Pod is in pending phase. However, this does not reflect the actual state,
-	// therefore we additionally check if the StatefulSet has the required number of readyReplicas.
-	//
-	// This additional check also helps with Pods in terminating state, which otherwise would show up
-	// as Pods with PodPhase = Running.
 	stss := &appsv1.StatefulSetList{}
-	err := c.List(ctx, stss, opts...)
+	err = c.List(ctx, stss, client.InNamespace(tempo.Namespace))
 	if err != nil {
 		return nil, err
 	}
-	for _, sts := range stss.Items {
-		if sts.Status.ReadyReplicas < ptr.Deref(sts.Spec.Replicas, 1) {
-			psm[corev1.PodPending] = append(psm[corev1.PodPending], sts.Name)
-			return psm, nil
+	for i := range stss.Items {
+		if metav1.IsControlledBy(&stss.Items[i], &tempo) {
+			workloads = append(workloads, &stss.Items[i])
 		}
 	}
 
-	return getPodsStatus(ctx, c, namespace, name, component)
+	return workloads, nil
 }
 
-func getComponentsStatus(ctx context.Context, client client.Client, tempo v1alpha1.TempoMicroservices) (v1alpha1.ComponentStatus, error) {
-	var err error
-	components := v1alpha1.ComponentStatus{}
+// getWorkloadStatus returns the pod status of the pods selected by a Deployment or StatefulSet.
+func getWorkloadStatus(ctx context.Context, c client.Client, workload client.Object) (v1alpha1.PodStatusMap, []podFailure, error) {
+	var labelSelector *metav1.LabelSelector
+	switch workload := workload.(type) {
+	case *appsv1.Deployment:
+		labelSelector = workload.Spec.Selector
+	case *appsv1.StatefulSet:
+		labelSelector = workload.Spec.Selector
+	}
 
-	components.Compactor, err = getPodsStatus(ctx, client, tempo.Namespace, tempo.Name, "compactor")
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
 	if err != nil {
-		return v1alpha1.ComponentStatus{}, fmt.Errorf("cannot get pod status: %w", err)
+		return nil, nil, err
 	}
-
-	components.Distributor, err = getPodsStatus(ctx, client, tempo.Namespace, tempo.Name, "distributor")
+	psm, failures, err := listPodsStatus(ctx, c, workload.GetNamespace(), selector)
 	if err != nil {
-		return v1alpha1.ComponentStatus{}, fmt.Errorf("cannot get pod status: %w", err)
+		return nil, nil, err
 	}
 
-	components.Ingester, err = getStatefulSetStatus(ctx, client, tempo.Namespace, tempo.Name, "ingester")
-	if err != nil {
-		return v1alpha1.ComponentStatus{}, fmt.Errorf("cannot get pod status: %w", err)
+	// After creation of a StatefulSet, but before the Pods are created, the list of Pods is empty
+	// and therefore no Pod is in pending phase. However, this does not reflect the actual state,
+	// therefore we additionally check if the StatefulSet has the required number of readyReplicas.
+	//
+	// This additional check also helps with Pods in terminating state, which otherwise would show up
+	// as Pods with PodPhase = Running.
+	if sts, ok := workload.(*appsv1.StatefulSet); ok && sts.Status.ReadyReplicas < ptr.Deref(sts.Spec.Replicas, 1) &&
+		len(psm[corev1.PodPending]) == 0 && len(psm[corev1.PodFailed]) == 0 {
+		psm[corev1.PodPending] = append(psm[corev1.PodPending], sts.Name)
 	}
+	return psm, failures, nil
+}
 
-	components.Querier, err = getPodsStatus(ctx, client, tempo.Namespace, tempo.Name, "querier")
-	if err != nil {
-		return v1alpha1.ComponentStatus{}, fmt.Errorf("cannot get pod status: %w", err)
+// getComponentsStatus returns the pod status and conditions of all components, grouped by the component label of the workloads,
+// and the failures of the failed pods.
+func getComponentsStatus(ctx context.Context, c client.Client, tempo v1alpha1.TempoMicroservices, workloads []client.Object) ([]v1alpha1.ComponentStatus, []podFailure, error) {
+	components := map[string]*v1alpha1.ComponentStatus{}
+	componentWorkloads := map[string][]client.Object{}
+	failures := []podFailure{}
+	for _, workload := range workloads {
+		name := workload.GetLabels()[componentLabel]
+		if name == "" {
+			continue
+		}
+
+		psm, workloadFailures, err := getWorkloadStatus(ctx, c, workload)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot get pod status: %w", err)
+		}
+		failures = append(failures, workloadFailures...)
+
+		component, ok := components[name]
+		if !ok {
+			component = &v1alpha1.ComponentStatus{Component: name, Pods: v1alpha1.PodStatusMap{}}
+			components[name] = component
+		}
+		for phase, pods := range psm {
+			component.Pods[phase] = append(component.Pods[phase], pods...)
+		}
+		componentWorkloads[name] = append(componentWorkloads[name], workload)
+
+		if zone, ok := workload.GetLabels()[v1alpha1.ZoneLabel]; ok {
+			if component.Zones == nil {
+				component.Zones = map[string]v1alpha1.PodStatusMap{}
+			}
+			component.Zones[zone] = psm
+		}
 	}
 
-	components.QueryFrontend, err = getPodsStatus(ctx, client, tempo.Namespace, tempo.Name, "query-frontend")
-	if err != nil {
-		return v1alpha1.ComponentStatus{}, fmt.Errorf("cannot get pod status: %w", err)
+	existing := map[string][]metav1.Condition{}
+	for _, component := range tempo.Status.Components {
+		existing[component.Component] = component.Conditions
 	}
 
-	components.Observatorium, err = getPodsStatus(ctx, client, tempo.Namespace, tempo.Name, "observatorium")
-	if err != nil {
-		return v1alpha1.ComponentStatus{}, fmt.Errorf("cannot get pod status: %w", err)
+	status := []v1alpha1.ComponentStatus{}
+	for name, component := range components {
+		component.Conditions = componentConditions(existing[name], componentWorkloads[name])
+		status = append(status, *component)
 	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Component < status[j].Component
+	})
+	return status, failures, nil
+}
 
-	return components, nil
+// countPods returns the number of pods of all components in a phase.
+func countPods(componentsStatus []v1alpha1.ComponentStatus, phase corev1.PodPhase) int {
+	count := 0
+	for _, component := range componentsStatus {
+		count += len(component.Pods[phase])
+	}
+	return count
 }
 
 func conditionStatus(active bool) metav1.ConditionStatus {
@@ -163,16 +294,11 @@ func resetCondition(conditions []metav1.Condition, conditionType v1alpha1.Condit
 	}
 }
 
-func updateConditions(conditions *[]metav1.Condition, componentsStatus v1alpha1.ComponentStatus, reconcileError error) bool {
+func updateConditions(conditions *[]metav1.Condition, componentsStatus []v1alpha1.ComponentStatus, failures []podFailure, reconcileError error) bool {
 	isTerminalError := false
 
 	// set PendingComponents condition if any pod of any component is in pending phase (or running but not ready)
-	countPending := len(componentsStatus.Compactor[corev1.PodPending]) +
-		len(componentsStatus.Distributor[corev1.PodPending]) +
-		len(componentsStatus.Ingester[corev1.PodPending]) +
-		len(componentsStatus.Querier[corev1.PodPending]) +
-		len(componentsStatus.QueryFrontend[corev1.PodPending]) +
-		len(componentsStatus.Observatorium[corev1.PodPending])
+	countPending := countPods(componentsStatus, corev1.PodPending)
 	pending := metav1.Condition{
 		Type:    string(v1alpha1.ConditionPending),
 		Reason:  string(v1alpha1.ReasonPendingComponents),
@@ -190,25 +316,15 @@ func updateConditions(conditions *[]metav1.Condition, componentsStatus v1alpha1.
 			Message: cerr.Message,
 			Status:  metav1.ConditionTrue,
 		}
-		isTerminalError = true
+		isTerminalError = !cerr.Retry
 	} else {
 		configurationError = resetCondition(*conditions, v1alpha1.ConditionConfigurationError, v1alpha1.ReasonInvalidStorageConfig)
 	}
 
 	// set Failed condition if the reconcile function returned any error other than ConfigurationError,
 	// or if any pod of any component is in failed phase
-	countFailed := len(componentsStatus.Compactor[corev1.PodFailed]) +
-		len(componentsStatus.Distributor[corev1.PodFailed]) +
-		len(componentsStatus.Ingester[corev1.PodFailed]) +
-		len(componentsStatus.Querier[corev1.PodFailed]) +
-		len(componentsStatus.QueryFrontend[corev1.PodFailed]) +
-		len(componentsStatus.Observatorium[corev1.PodFailed])
-	countUnknown := len(componentsStatus.Compactor[corev1.PodUnknown]) +
-		len(componentsStatus.Distributor[corev1.PodUnknown]) +
-		len(componentsStatus.Ingester[corev1.PodUnknown]) +
-		len(componentsStatus.Querier[corev1.PodUnknown]) +
-		len(componentsStatus.QueryFrontend[corev1.PodUnknown]) +
-		len(componentsStatus.Observatorium[corev1.PodUnknown])
+	countFailed := countPods(componentsStatus, corev1.PodFailed)
+	countUnknown := countPods(componentsStatus, corev1.PodUnknown)
 	var failed metav1.Condition
 	if reconcileError != nil && cerr == nil {
 		failed = metav1.Condition{
@@ -217,6 +333,18 @@ func updateConditions(conditions *[]metav1.Condition, componentsStatus v1alpha1.
 			Message: reconcileError.Error(),
 			Status:  metav1.ConditionTrue,
 		}
+	} else if len(failures) > 0 {
+		// the reason of the first failure is used as reason of the condition, the message lists all failures
+		messages := []string{}
+		for _, f := range failures {
+			messages = append(messages, f.message)
+		}
+		failed = metav1.Condition{
+			Type:    string(v1alpha1.ConditionFailed),
+			Reason:  string(failures[0].reason),
+			Message: fmt.Sprintf("%s: %s", messageFailed, strings.Join(messages, "; ")),
+			Status:  metav1.ConditionTrue,
+		}
 	} else if countFailed > 0 || countUnknown > 0 {
 		failed = metav1.Condition{
 			Type:    string(v1alpha1.ConditionFailed),
@@ -247,6 +375,61 @@ func updateConditions(conditions *[]metav1.Condition, componentsStatus v1alpha1.
 	return isTerminalError
 }
 
+// SetScalingDownCondition enables the ScalingDown condition with a message describing the progress of the scale-down,
+// or disables the condition if the message is empty.
+func SetScalingDownCondition(conditions *[]metav1.Condition, message string) {
+	if message == "" {
+		if meta.FindStatusCondition(*conditions, string(v1alpha1.ConditionScalingDown)) != nil {
+			meta.SetStatusCondition(conditions, resetCondition(*conditions, v1alpha1.ConditionScalingDown, v1alpha1.ReasonShuttingDownIngesters))
+		}
+		return
+	}
+
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:    string(v1alpha1.ConditionScalingDown),
+		Reason:  string(v1alpha1.ReasonShuttingDownIngesters),
+		Message: message,
+		Status:  metav1.ConditionTrue,
+	})
+}
+
+// setObservedGeneration sets the generation of the TempoMicroservices resource on the status and on all conditions,
+// to indicate which generation of the spec is reflected in the status.
+func setObservedGeneration(status *v1alpha1.TempoMicroservicesStatus, generation int64) {
+	status.ObservedGeneration = generation
+	for i := range status.Conditions {
+		status.Conditions[i].ObservedGeneration = generation
+	}
+	for i := range status.Components {
+		for j := range status.Components[i].Conditions {
+			status.Components[i].Conditions[j].ObservedGeneration = generation
+		}
+	}
+}
+
+// recordConditionTransitions emits an event for every condition which changed its status.
+// New conditions are only reported if they are true.
+func recordConditionTransitions(recorder record.EventRecorder, tempo *v1alpha1.TempoMicroservices, existing []metav1.Condition, conditions []metav1.Condition) {
+	for _, condition := range conditions {
+		previous := meta.FindStatusCondition(existing, condition.Type)
+		if (previous == nil && condition.Status != metav1.ConditionTrue) || (previous != nil && previous.Status == condition.Status) {
+			continue
+		}
+
+		eventType := corev1.EventTypeNormal
+		if (condition.Status == metav1.ConditionTrue && (condition.Type == string(v1alpha1.ConditionFailed) || condition.Type == string(v1alpha1.ConditionConfigurationError))) ||
+			(condition.Status != metav1.ConditionTrue && condition.Type == string(v1alpha1.ConditionReady)) {
+			eventType = corev1.EventTypeWarning
+		}
+
+		message := fmt.Sprintf("Condition %s changed to %s", condition.Type, condition.Status)
+		if condition.Status == metav1.ConditionTrue && condition.Message != "" {
+			message = fmt.Sprintf("%s: %s", message, condition.Message)
+		}
+		recorder.Event(tempo, eventType, "ConditionChanged", message)
+	}
+}
+
 func patchStatus(ctx context.Context, c client.Client, original v1alpha1.TempoMicroservices, status v1alpha1.TempoMicroservicesStatus) error {
 	patch := client.MergeFrom(&original)
 	updated := original.DeepCopy()
@@ -254,19 +437,39 @@ func patchStatus(ctx context.Context, c client.Client, original v1alpha1.TempoMi
 	return c.Status().Patch(ctx, updated, patch)
 }
 
-// HandleStatus updates the .status field of a TempoMicroservices CR
+// HandleStatus updates the .status field of a TempoMicroservices CR.
+// The status argument contains the status fields populated by the reconcile function,
+// the components status and conditions are computed here.
+// If health probes are enabled, the Tempo components are probed with the probe created by the reconcile function.
 // Status Conditions API conventions: https://github.com/kubernetes/community/blob/c04227d209633696ad49d7f4546fc8cfd9c660ab/contributors/devel/sig-architecture/api-conventions.md#typical-status-properties
-func HandleStatus(ctx context.Context, client client.Client, tempo v1alpha1.TempoMicroservices, reconcileError error) error {
+func HandleStatus(
+	ctx context.Context,
+	client client.Client,
+	recorder record.EventRecorder,
+	tempo v1alpha1.TempoMicroservices,
+	status v1alpha1.TempoMicroservicesStatus,
+	probe *ServingProbe,
+	reconcileError error,
+) error {
 	var err error
 	log := ctrl.LoggerFrom(ctx)
-	status := *tempo.Status.DeepCopy()
 
-	status.Components, err = getComponentsStatus(ctx, client, tempo)
+	var failures []podFailure
+	workloads, err := listWorkloads(ctx, client, tempo)
 	if err != nil {
-		log.Error(err, "could not get status of each component")
+		log.Error(err, "could not list workloads")
+	} else {
+		status.Summary = getSummary(workloads)
+		status.Components, failures, err = getComponentsStatus(ctx, client, tempo, workloads)
+		if err != nil {
+			log.Error(err, "could not get status of each component")
+		}
 	}
 
-	isTerminalError := updateConditions(&status.Conditions, status.Components, reconcileError)
+	isTerminalError := updateConditions(&status.Conditions, status.Components, failures, reconcileError)
+	setServingCondition(ctx, &status.Conditions, tempo, probe)
+	setObservedGeneration(&status, tempo.Generation)
+	recordConditionTransitions(recorder, &tempo, tempo.Status.Conditions, status.Conditions)
 	if isTerminalError {
 		// wrap error in reconcile.TerminalError to indicate human intervention is required
 		// and the request should not be requeued.
@@ -0,0 +1,256 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1alpha1 "github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+)
+
+func newTestPod(name string, labels map[string]string, phase corev1.PodPhase, ready bool) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+		Status: corev1.PodStatus{
+			Phase:             phase,
+			ContainerStatuses: []corev1.ContainerStatus{{Name: "tempo", Ready: ready}},
+		},
+	}
+}
+
+func newTestStatefulSet(name string, labels map[string]string, replicas int32, readyReplicas int32) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: ptr.To(replicas),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+		},
+		Status: appsv1.StatefulSetStatus{ReadyReplicas: readyReplicas},
+	}
+}
+
+var _ = Describe("Components status", func() {
+	ctx := context.Background()
+	distributorLabels := map[string]string{componentLabel: "distributor"}
+	zoneALabels := map[string]string{componentLabel: "ingester", v1alpha1.ZoneLabel: "zone-a"}
+	zoneBLabels := map[string]string{componentLabel: "ingester", v1alpha1.ZoneLabel: "zone-b"}
+
+	distributor := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "tempo-distributor", Namespace: "default", Labels: distributorLabels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To(int32(2)),
+			Selector: &metav1.LabelSelector{MatchLabels: distributorLabels},
+		},
+	}
+
+	getStatus := func(workloads []client.Object, objects ...client.Object) ([]v1alpha1.ComponentStatus, []podFailure) {
+		k8sclient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build()
+		status, failures, err := getComponentsStatus(ctx, k8sclient, v1alpha1.TempoMicroservices{}, workloads)
+		Expect(err).NotTo(HaveOccurred())
+		return status, failures
+	}
+
+	It("groups the pods by the component of the workloads", func() {
+		status, failures := getStatus(
+			[]client.Object{distributor, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled"}}},
+			newTestPod("tempo-distributor-a", distributorLabels, corev1.PodRunning, true),
+			newTestPod("tempo-distributor-b", distributorLabels, corev1.PodRunning, false),
+		)
+
+		Expect(failures).To(BeEmpty())
+		Expect(status).To(HaveLen(1))
+		Expect(status[0].Component).To(Equal("distributor"))
+		Expect(status[0].Pods).To(Equal(v1alpha1.PodStatusMap{
+			corev1.PodRunning: []string{"tempo-distributor-a"},
+			corev1.PodPending: []string{"tempo-distributor-b"},
+		}))
+	})
+
+	It("reports the pods of each zone", func() {
+		status, _ := getStatus(
+			[]client.Object{
+				distributor,
+				newTestStatefulSet("tempo-ingester-zone-a", zoneALabels, 1, 1),
+				newTestStatefulSet("tempo-ingester-zone-b", zoneBLabels, 1, 1),
+			},
+			newTestPod("tempo-ingester-zone-a-0", zoneALabels, corev1.PodRunning, true),
+			newTestPod("tempo-ingester-zone-b-0", zoneBLabels, corev1.PodRunning, true),
+		)
+
+		Expect(status).To(HaveLen(2))
+		Expect(status[0].Component).To(Equal("distributor"))
+		Expect(status[1].Component).To(Equal("ingester"))
+		Expect(status[1].Pods[corev1.PodRunning]).To(ConsistOf("tempo-ingester-zone-a-0", "tempo-ingester-zone-b-0"))
+		Expect(status[1].Zones).To(Equal(map[string]v1alpha1.PodStatusMap{
+			"zone-a": {corev1.PodRunning: []string{"tempo-ingester-zone-a-0"}},
+			"zone-b": {corev1.PodRunning: []string{"tempo-ingester-zone-b-0"}},
+		}))
+	})
+
+	It("reports a StatefulSet without pods as pending", func() {
+		status, _ := getStatus([]client.Object{newTestStatefulSet("tempo-ingester-zone-a", zoneALabels, 1, 0)})
+
+		Expect(status).To(HaveLen(1))
+		Expect(status[0].Pods[corev1.PodPending]).To(Equal([]string{"tempo-ingester-zone-a"}))
+	})
+
+	It("reports pods with failed containers as failed", func() {
+		pod := newTestPod("tempo-distributor-a", distributorLabels, corev1.PodRunning, false)
+		pod.Status.ContainerStatuses[0].State.Waiting = &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "not found"}
+		status, failures := getStatus([]client.Object{distributor}, pod)
+
+		Expect(status[0].Pods).To(Equal(v1alpha1.PodStatusMap{corev1.PodFailed: []string{"tempo-distributor-a"}}))
+		Expect(failures).To(HaveLen(1))
+		Expect(failures[0].reason).To(Equal(v1alpha1.ReasonImagePullFailed))
+	})
+})
+
+var _ = Describe("Pod failure", func() {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	pod := func(ready bool, waiting string, lastTermination string, finishedAt time.Time) corev1.Pod {
+		pod := newTestPod("tempo-ingester-0", nil, corev1.PodRunning, ready)
+		status := &pod.Status.ContainerStatuses[0]
+		status.RestartCount = 3
+		if waiting != "" {
+			status.State.Waiting = &corev1.ContainerStateWaiting{Reason: waiting, Message: "message"}
+		}
+		if lastTermination != "" {
+			status.LastTerminationState.Terminated = &corev1.ContainerStateTerminated{
+				Reason:     lastTermination,
+				ExitCode:   137,
+				FinishedAt: metav1.NewTime(finishedAt),
+			}
+		}
+		return *pod
+	}
+
+	DescribeTable("detects failed containers",
+		func(pod corev1.Pod, reason v1alpha1.ConditionReason, message string) {
+			failure := getPodFailure(pod, now)
+			if reason == "" {
+				Expect(failure).To(BeNil())
+				return
+			}
+			Expect(failure).NotTo(BeNil())
+			Expect(failure.reason).To(Equal(reason))
+			Expect(failure.message).To(Equal(message))
+		},
+		Entry("ready container", pod(true, "", "OOMKilled", now), v1alpha1.ConditionReason(""), ""),
+		Entry("starting container", pod(false, "ContainerCreating", "", time.Time{}), v1alpha1.ConditionReason(""), ""),
+		Entry("image pull error", pod(false, "ImagePullBackOff", "", time.Time{}), v1alpha1.ReasonImagePullFailed,
+			"pod tempo-ingester-0 container tempo: ImagePullBackOff: message"),
+		Entry("crash loop", pod(false, "CrashLoopBackOff", "Error", now.Add(-time.Hour)), v1alpha1.ReasonCrashLooping,
+			"pod tempo-ingester-0 container tempo restarted 3 times, last termination: Error (exit code 137)"),
+		Entry("recently out of memory", pod(false, "", "OOMKilled", now.Add(-time.Minute)), v1alpha1.ReasonOOMKilled,
+			"pod tempo-ingester-0 container tempo restarted 3 times, last termination: OOMKilled (exit code 137)"),
+		Entry("out of memory a long time ago", pod(false, "", "OOMKilled", now.Add(-time.Hour)), v1alpha1.ConditionReason(""), ""),
+		Entry("crash loop after running out of memory", pod(false, "CrashLoopBackOff", "OOMKilled", now.Add(-time.Hour)), v1alpha1.ReasonOOMKilled,
+			"pod tempo-ingester-0 container tempo restarted 3 times, last termination: OOMKilled (exit code 137)"),
+	)
+})
+
+var _ = Describe("Conditions", func() {
+	running := []v1alpha1.ComponentStatus{{Component: "distributor", Pods: v1alpha1.PodStatusMap{corev1.PodRunning: []string{"a"}}}}
+	pending := []v1alpha1.ComponentStatus{{Component: "distributor", Pods: v1alpha1.PodStatusMap{corev1.PodPending: []string{"a"}}}}
+	failed := []v1alpha1.ComponentStatus{{Component: "distributor", Pods: v1alpha1.PodStatusMap{corev1.PodFailed: []string{"a"}}}}
+
+	findCondition := func(conditions []metav1.Condition, conditionType v1alpha1.ConditionStatus) *metav1.Condition {
+		condition := meta.FindStatusCondition(conditions, string(conditionType))
+		Expect(condition).NotTo(BeNil())
+		return condition
+	}
+
+	It("is ready if all components are running", func() {
+		conditions := []metav1.Condition{}
+		Expect(updateConditions(&conditions, running, nil, nil)).To(BeFalse())
+
+		Expect(findCondition(conditions, v1alpha1.ConditionReady).Status).To(Equal(metav1.ConditionTrue))
+		Expect(findCondition(conditions, v1alpha1.ConditionPending).Status).To(Equal(metav1.ConditionFalse))
+		Expect(findCondition(conditions, v1alpha1.ConditionFailed).Status).To(Equal(metav1.ConditionFalse))
+		Expect(findCondition(conditions, v1alpha1.ConditionConfigurationError).Status).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("is pending if a pod is pending", func() {
+		conditions := []metav1.Condition{}
+		updateConditions(&conditions, pending, nil, nil)
+
+		Expect(findCondition(conditions, v1alpha1.ConditionPending).Status).To(Equal(metav1.ConditionTrue))
+		Expect(findCondition(conditions, v1alpha1.ConditionReady).Status).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("lists the pod failures", func() {
+		conditions := []metav1.Condition{}
+		failures := []podFailure{
+			{reason: v1alpha1.ReasonOOMKilled, message: "pod a out of memory"},
+			{reason: v1alpha1.ReasonCrashLooping, message: "pod b crash loop"},
+		}
+		updateConditions(&conditions, failed, failures, nil)
+
+		condition := findCondition(conditions, v1alpha1.ConditionFailed)
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(string(v1alpha1.ReasonOOMKilled)))
+		Expect(condition.Message).To(Equal(messageFailed + ": pod a out of memory; pod b crash loop"))
+		Expect(findCondition(conditions, v1alpha1.ConditionReady).Status).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("is failed if a pod failed", func() {
+		conditions := []metav1.Condition{}
+		updateConditions(&conditions, failed, nil, nil)
+
+		condition := findCondition(conditions, v1alpha1.ConditionFailed)
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(string(v1alpha1.ReasonFailedComponents)))
+	})
+
+	It("reports a reconcile error", func() {
+		conditions := []metav1.Condition{}
+		Expect(updateConditions(&conditions, running, nil, errors.New("cannot apply manifests"))).To(BeFalse())
+
+		condition := findCondition(conditions, v1alpha1.ConditionFailed)
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(string(v1alpha1.ReasonFailedReconciliation)))
+		Expect(condition.Message).To(Equal("cannot apply manifests"))
+	})
+
+	It("reports a configuration error as terminal error", func() {
+		conditions := []metav1.Condition{}
+		err := &ConfigurationError{Reason: v1alpha1.ReasonInvalidStorageConfig, Message: "invalid storage"}
+		Expect(updateConditions(&conditions, running, nil, err)).To(BeTrue())
+
+		condition := findCondition(conditions, v1alpha1.ConditionConfigurationError)
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(string(v1alpha1.ReasonInvalidStorageConfig)))
+		Expect(findCondition(conditions, v1alpha1.ConditionFailed).Status).To(Equal(metav1.ConditionFalse))
+		Expect(findCondition(conditions, v1alpha1.ConditionReady).Status).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("reports a configuration error which is retried as non-terminal error", func() {
+		conditions := []metav1.Condition{}
+		err := &ConfigurationError{Reason: v1alpha1.ReasonInvalidStorageConfig, Message: "secret does not exist", Retry: true}
+		Expect(updateConditions(&conditions, running, nil, err)).To(BeFalse())
+		Expect(findCondition(conditions, v1alpha1.ConditionConfigurationError).Status).To(Equal(metav1.ConditionTrue))
+	})
+
+	It("resets a previous failure", func() {
+		conditions := []metav1.Condition{}
+		updateConditions(&conditions, failed, nil, nil)
+		updateConditions(&conditions, running, nil, nil)
+
+		condition := findCondition(conditions, v1alpha1.ConditionFailed)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(string(v1alpha1.ReasonFailedComponents)))
+		Expect(condition.Message).To(Equal(messageFailed))
+	})
+})
@@ -0,0 +1,47 @@
+package status
+
+import (
+	"errors"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1alpha1 "github.com/andreasgerstmayr/tempo-helm-operator/api/v1alpha1"
+	"github.com/andreasgerstmayr/tempo-helm-operator/internal/storageprobe"
+)
+
+// SetStorageUnreachableCondition sets the StorageUnreachable condition from the result of the storage probe.
+func SetStorageUnreachableCondition(conditions *[]metav1.Condition, probeErr error) {
+	if probeErr == nil {
+		meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:    string(v1alpha1.ConditionStorageUnreachable),
+			Reason:  string(v1alpha1.ReasonStorageReachable),
+			Message: "The bucket was listed, and a sentinel object was written and deleted",
+			Status:  metav1.ConditionFalse,
+		})
+		return
+	}
+
+	reason := v1alpha1.ReasonStorageProbeFailed
+	if errors.Is(probeErr, storageprobe.ErrBucketNotFound) {
+		reason = v1alpha1.ReasonBucketNotFound
+	} else if errors.Is(probeErr, storageprobe.ErrAccessDenied) {
+		reason = v1alpha1.ReasonAccessDenied
+	}
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:    string(v1alpha1.ConditionStorageUnreachable),
+		Reason:  string(reason),
+		Message: probeErr.Error(),
+		Status:  metav1.ConditionTrue,
+	})
+}
+
+// SetStorageProbeSkippedCondition sets the StorageUnreachable condition to unknown, if the storage probe does not support the storage backend.
+func SetStorageProbeSkippedCondition(conditions *[]metav1.Condition, message string) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:    string(v1alpha1.ConditionStorageUnreachable),
+		Reason:  string(v1alpha1.ReasonStorageProbeSkipped),
+		Message: message,
+		Status:  metav1.ConditionUnknown,
+	})
+}
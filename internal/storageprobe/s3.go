@@ -0,0 +1,96 @@
+package storageprobe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// SentinelObject is the name of the object which is written to and deleted from the bucket.
+const SentinelObject = "tempo-operator-storage-probe"
+
+// probeTimeout is the timeout of the probe, which runs before the manifests are applied.
+const probeTimeout = 10 * time.Second
+
+var (
+	// ErrBucketNotFound is returned if the bucket does not exist.
+	ErrBucketNotFound = errors.New("bucket not found")
+	// ErrAccessDenied is returned if the credentials are invalid, or not authorized to access the bucket.
+	ErrAccessDenied = errors.New("access denied")
+)
+
+// S3Config contains the settings of the s3 trace storage backend of Tempo.
+type S3Config struct {
+	Bucket             string
+	Prefix             string
+	Endpoint           string
+	Region             string
+	AccessKey          string
+	SecretKey          string
+	SessionToken       string
+	Insecure           bool
+	InsecureSkipVerify bool
+	ForcePathStyle     bool
+}
+
+// ProbeS3 lists the bucket, then writes and deletes a sentinel object.
+func ProbeS3(ctx context.Context, cfg S3Config) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	bucketLookup := minio.BucketLookupAuto
+	if cfg.ForcePathStyle {
+		bucketLookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, cfg.SessionToken),
+		Secure:       !cfg.Insecure,
+		Region:       cfg.Region,
+		BucketLookup: bucketLookup,
+		Transport:    transport,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %w", cfg.Endpoint, err)
+	}
+
+	for obj := range client.ListObjects(ctx, cfg.Bucket, minio.ListObjectsOptions{Prefix: cfg.Prefix, MaxKeys: 1}) {
+		if obj.Err != nil {
+			return probeError(fmt.Sprintf("cannot list bucket %s", cfg.Bucket), obj.Err)
+		}
+	}
+
+	key := path.Join(cfg.Prefix, SentinelObject)
+	data := []byte(time.Now().UTC().Format(time.RFC3339))
+	_, err = client.PutObject(ctx, cfg.Bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "text/plain"})
+	if err != nil {
+		return probeError(fmt.Sprintf("cannot write object %s to bucket %s", key, cfg.Bucket), err)
+	}
+
+	err = client.RemoveObject(ctx, cfg.Bucket, key, minio.RemoveObjectOptions{})
+	if err != nil {
+		return probeError(fmt.Sprintf("cannot delete object %s from bucket %s", key, cfg.Bucket), err)
+	}
+	return nil
+}
+
+// probeError wraps the error of a failed request, and classifies it as ErrBucketNotFound or ErrAccessDenied.
+func probeError(msg string, err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchBucket":
+		return fmt.Errorf("%s: %w: %v", msg, ErrBucketNotFound, err)
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken", "InvalidToken":
+		return fmt.Errorf("%s: %w: %v", msg, ErrAccessDenied, err)
+	default:
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+}
@@ -0,0 +1,150 @@
+package storageprobe
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// minioStandIn implements the subset of the S3 API of MinIO used by the probe, with path-style bucket lookup.
+type minioStandIn struct {
+	accessKey string
+	buckets   map[string]map[string][]byte
+
+	mu       sync.Mutex
+	requests []string
+}
+
+type listBucketResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name     string   `xml:"Name"`
+	Prefix   string   `xml:"Prefix"`
+	KeyCount int      `xml:"KeyCount"`
+	MaxKeys  int      `xml:"MaxKeys"`
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int    `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated bool `xml:"IsTruncated"`
+}
+
+func (m *minioStandIn) writeError(w http.ResponseWriter, status int, code string, resource string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message><Resource>%s</Resource><RequestId>1</RequestId></Error>`, code, code, resource)
+}
+
+func (m *minioStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, fmt.Sprintf("%s /%s/%s", r.Method, bucket, key))
+
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential="+m.accessKey+"/") {
+		m.writeError(w, http.StatusForbidden, "InvalidAccessKeyId", r.URL.Path)
+		return
+	}
+	objects, ok := m.buckets[bucket]
+	if !ok {
+		m.writeError(w, http.StatusNotFound, "NoSuchBucket", r.URL.Path)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		query, _ := url.ParseQuery(r.URL.RawQuery)
+		result := listBucketResult{Name: bucket, Prefix: query.Get("prefix"), MaxKeys: 1000}
+		for k, v := range objects {
+			if strings.HasPrefix(k, result.Prefix) {
+				result.Contents = append(result.Contents, struct {
+					Key  string `xml:"Key"`
+					Size int    `xml:"Size"`
+				}{Key: k, Size: len(v)})
+			}
+		}
+		result.KeyCount = len(result.Contents)
+		w.Header().Set("Content-Type", "application/xml")
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		objects[key] = data
+		w.Header().Set("ETag", `"1"`)
+	case r.Method == http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+var _ = Describe("S3 storage probe", func() {
+	ctx := context.Background()
+
+	var minio *minioStandIn
+	var server *httptest.Server
+	var cfg S3Config
+
+	BeforeEach(func() {
+		minio = &minioStandIn{
+			accessKey: "tempo",
+			buckets: map[string]map[string][]byte{
+				"tempo": {"single-tenant/block/meta.json": []byte("{}")},
+			},
+		}
+		server = httptest.NewServer(minio)
+
+		cfg = S3Config{
+			Bucket:    "tempo",
+			Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+			Region:    "us-east-1",
+			AccessKey: "tempo",
+			SecretKey: "supersecret",
+			Insecure:  true,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("lists the bucket, writes and deletes a sentinel object", func() {
+		cfg.Prefix = "traces"
+		Expect(ProbeS3(ctx, cfg)).To(Succeed())
+		Expect(minio.requests).To(Equal([]string{
+			"GET /tempo/",
+			"PUT /tempo/traces/" + SentinelObject,
+			"DELETE /tempo/traces/" + SentinelObject,
+		}))
+		Expect(minio.buckets["tempo"]).To(HaveLen(1))
+	})
+
+	It("reports a wrong bucket name", func() {
+		cfg.Bucket = "tmepo"
+		err := ProbeS3(ctx, cfg)
+		Expect(err).To(MatchError(ErrBucketNotFound))
+		Expect(err.Error()).To(HavePrefix("cannot list bucket tmepo: bucket not found"))
+	})
+
+	It("reports invalid credentials", func() {
+		cfg.AccessKey = "invalid"
+		err := ProbeS3(ctx, cfg)
+		Expect(err).To(MatchError(ErrAccessDenied))
+	})
+
+	It("reports an unreachable endpoint", func() {
+		server.Close()
+		err := ProbeS3(ctx, cfg)
+		Expect(err).To(HaveOccurred())
+		Expect(err).NotTo(MatchError(ErrBucketNotFound))
+		Expect(err).NotTo(MatchError(ErrAccessDenied))
+	})
+})
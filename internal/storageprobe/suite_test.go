@@ -0,0 +1,14 @@
+package storageprobe
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestStorageProbe(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Storage Probe Suite")
+}
@@ -0,0 +1,82 @@
+package tempoapi
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPPort is the HTTP port of all Tempo components, as configured by the helm chart.
+const HTTPPort = 3100
+
+const requestTimeout = 30 * time.Second
+
+// Client calls the HTTP API of Tempo components.
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient creates a new client. If tlsConfig is nil, plain HTTP is used.
+func NewClient(tlsConfig *tls.Config) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Client{
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   requestTimeout,
+		},
+	}
+}
+
+func (c *Client) do(ctx context.Context, method string, url string, header http.Header, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s returned status %d: %s", method, url, resp.StatusCode, respBody)
+	}
+	return respBody, nil
+}
+
+// Flush flushes all in-memory traces of an ingester to the WAL.
+func (c *Client) Flush(ctx context.Context, baseURL string) error {
+	_, err := c.do(ctx, http.MethodPost, baseURL+"/flush", nil, nil)
+	return err
+}
+
+// Shutdown flushes all in-memory traces and the WAL of an ingester to the backend,
+// removes the ingester from the ring and shuts down the ingester service.
+func (c *Client) Shutdown(ctx context.Context, baseURL string) error {
+	_, err := c.do(ctx, http.MethodPost, baseURL+"/shutdown", nil, nil)
+	return err
+}
+
+// Ready checks if a component is ready to serve requests.
+func (c *Client) Ready(ctx context.Context, baseURL string) error {
+	_, err := c.do(ctx, http.MethodGet, baseURL+"/ready", nil, nil)
+	return err
+}
+
+// Echo checks if the query-frontend serves API requests.
+func (c *Client) Echo(ctx context.Context, baseURL string) error {
+	_, err := c.do(ctx, http.MethodGet, baseURL+"/api/echo", nil, nil)
+	return err
+}
@@ -0,0 +1,95 @@
+package tempoapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tempo API client", func() {
+	ctx := context.Background()
+
+	var server *httptest.Server
+	var requests []string
+
+	BeforeEach(func() {
+		requests = []string{}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/flush", func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		})
+		mux.HandleFunc("/shutdown", func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			http.Error(w, "ingester is not running", http.StatusServiceUnavailable)
+		})
+		mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			_, _ = w.Write([]byte("ready"))
+		})
+		mux.HandleFunc("/api/echo", func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			_, _ = w.Write([]byte("echo"))
+		})
+		mux.HandleFunc("/ingester/ring", func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			if r.Method == http.MethodPost {
+				requests = append(requests, "forget="+r.FormValue("forget"))
+				http.Redirect(w, r, r.URL.Path, http.StatusFound)
+				return
+			}
+			if r.Header.Get("Accept") != "application/json" {
+				_, _ = w.Write([]byte("<html></html>"))
+				return
+			}
+			_, _ = w.Write([]byte(`{"shards":[{"id":"tempo-ingester-0","state":"ACTIVE","address":"10.0.0.1:9095","timestamp":"2024-01-01 00:00:00 +0000 UTC","zone":"","tokens":[1,2]}],"now":"2024-01-01T00:00:00Z"}`))
+		})
+		server = httptest.NewServer(mux)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("flushes an ingester", func() {
+		Expect(NewClient(nil).Flush(ctx, server.URL)).To(Succeed())
+		Expect(requests).To(Equal([]string{"POST /flush"}))
+	})
+
+	It("returns an error for unsuccessful responses", func() {
+		err := NewClient(nil).Shutdown(ctx, server.URL)
+		Expect(err).To(MatchError(ContainSubstring("returned status 503: ingester is not running")))
+	})
+
+	It("checks if a component is ready", func() {
+		Expect(NewClient(nil).Ready(ctx, server.URL)).To(Succeed())
+		Expect(NewClient(nil).Echo(ctx, server.URL)).To(Succeed())
+		Expect(requests).To(Equal([]string{"GET /ready", "GET /api/echo"}))
+	})
+
+	It("reads the ingester ring", func() {
+		ring, err := NewClient(nil).IngesterRing(ctx, server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ring.Instances).To(HaveLen(1))
+		Expect(ring.Instance("tempo-ingester-0")).To(Equal(&RingInstance{
+			ID:        "tempo-ingester-0",
+			State:     InstanceStateActive,
+			Address:   "10.0.0.1:9095",
+			Timestamp: "2024-01-01 00:00:00 +0000 UTC",
+			Tokens:    []uint32{1, 2},
+		}))
+		heartbeat, err := ring.Instance("tempo-ingester-0").LastHeartbeat()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(heartbeat).To(BeTemporally("==", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+		Expect(ring.Instance("tempo-ingester-1")).To(BeNil())
+	})
+
+	It("forgets a ring instance", func() {
+		Expect(NewClient(nil).ForgetInstance(ctx, server.URL, "tempo-ingester-1")).To(Succeed())
+		Expect(requests).To(Equal([]string{"POST /ingester/ring", "forget=tempo-ingester-1", "GET /ingester/ring"}))
+	})
+})
@@ -0,0 +1,77 @@
+package tempoapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// States of a ring instance, as reported by the ring status page.
+const (
+	InstanceStateActive    = "ACTIVE"
+	InstanceStateJoining   = "JOINING"
+	InstanceStateLeaving   = "LEAVING"
+	InstanceStateUnhealthy = "UNHEALTHY"
+)
+
+// RingInstance is a member of a hash ring.
+type RingInstance struct {
+	ID        string   `json:"id"`
+	State     string   `json:"state"`
+	Address   string   `json:"address"`
+	Timestamp string   `json:"timestamp"`
+	Zone      string   `json:"zone"`
+	Tokens    []uint32 `json:"tokens"`
+}
+
+// heartbeatLayout is the format of the timestamp of the last heartbeat of a ring instance.
+const heartbeatLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// LastHeartbeat returns the time of the last heartbeat of the instance.
+func (i *RingInstance) LastHeartbeat() (time.Time, error) {
+	return time.Parse(heartbeatLayout, i.Timestamp)
+}
+
+// Ring is the state of a hash ring.
+type Ring struct {
+	Instances []RingInstance `json:"shards"`
+}
+
+// Instance returns the ring instance with the given ID, or nil if the instance is not a member of the ring.
+func (r *Ring) Instance(id string) *RingInstance {
+	for i := range r.Instances {
+		if r.Instances[i].ID == id {
+			return &r.Instances[i]
+		}
+	}
+	return nil
+}
+
+// IngesterRing returns the state of the ingester ring, as seen by the distributor.
+func (c *Client) IngesterRing(ctx context.Context, distributorURL string) (*Ring, error) {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	body, err := c.do(ctx, http.MethodGet, distributorURL+"/ingester/ring", header, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := &Ring{}
+	err = json.Unmarshal(body, ring)
+	if err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// ForgetInstance removes an instance from the ingester ring.
+func (c *Client) ForgetInstance(ctx context.Context, distributorURL string, id string) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	form := url.Values{"forget": []string{id}}
+	_, err := c.do(ctx, http.MethodPost, distributorURL+"/ingester/ring", header, strings.NewReader(form.Encode()))
+	return err
+}
@@ -0,0 +1,14 @@
+package tempoapi
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestTempoAPI(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Tempo API Suite")
+}